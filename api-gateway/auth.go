@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"platform"
+)
+
+// jwksTTL is how long a key set fetched from JWKSURL is used before it is
+// fetched again.
+const jwksTTL = 5 * time.Minute
+
+var authFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "gateway_auth_failures_total",
+	Help: "Requests rejected for a missing or invalid bearer token by reason.",
+}, []string{"reason"})
+
+type userKey struct{}
+
+// withUser returns a copy of ctx carrying the verified claims, which are
+// forwarded to upstreams.
+func withUser(ctx context.Context, claims *platform.Claims) context.Context {
+	return context.WithValue(ctx, userKey{}, claims)
+}
+
+// userFromContext returns the claims stored by requireAuth, or nil for
+// anonymous requests.
+func userFromContext(ctx context.Context) *platform.Claims {
+	claims, _ := ctx.Value(userKey{}).(*platform.Claims)
+	return claims
+}
+
+// newVerifier builds the token verifier described by config. HS256 tokens
+// are accepted when a secret is set, RS256 tokens when a key set is.
+func newVerifier(config Config) (*platform.JWTVerifier, error) {
+	verifier := &platform.JWTVerifier{
+		Issuer:   config.JWTIssuer,
+		Audience: config.JWTAudience,
+		Leeway:   config.JWTLeeway,
+	}
+	if config.JWTSecret != "" {
+		verifier.HMACSecret = []byte(config.JWTSecret)
+	}
+	switch {
+	case config.JWKSFile != "":
+		keys, err := platform.LoadJWKSFile(config.JWKSFile)
+		if err != nil {
+			return nil, err
+		}
+		verifier.Keys = keys
+	case config.JWKSURL != "":
+		verifier.Keys = platform.NewRemoteJWKS(config.JWKSURL, jwksTTL)
+	}
+	if verifier.HMACSecret == nil && verifier.Keys == nil {
+		slog.Warn("No JWT_SECRET or JWKS configured, authenticated routes reject every request")
+	}
+	return verifier, nil
+}
+
+// requireAuth rejects requests without a valid bearer token with 401 and
+// stores the verified claims in the request context.
+func requireAuth(verifier *platform.JWTVerifier) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, ok := bearerToken(r)
+			if !ok {
+				authFailures.WithLabelValues("missing").Inc()
+				w.Header().Set("WWW-Authenticate", `Bearer`)
+				platform.WriteError(w, r, http.StatusUnauthorized, platform.CodeUnauthorized, "Authentication required")
+				return
+			}
+
+			claims, err := verifier.Verify(r.Context(), token)
+			if err != nil {
+				reason, message := "invalid", "Invalid token"
+				if errors.Is(err, platform.ErrTokenExpired) {
+					reason, message = "expired", "Token expired"
+				}
+				authFailures.WithLabelValues(reason).Inc()
+				platform.Log(r.Context()).Warn("Rejected bearer token", "error", err)
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+				platform.WriteError(w, r, http.StatusUnauthorized, platform.CodeUnauthorized, message)
+				return
+			}
+
+			ctx := withUser(r.Context(), claims)
+			ctx = platform.WithLogger(ctx, platform.Log(ctx).With("user_id", claims.Subject))
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// requireRole rejects users authenticated by requireAuth whose role is
+// not one of roles with 403.
+func requireRole(roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims := userFromContext(r.Context())
+			if claims == nil || !containsRole(roles, claims.User().Role) {
+				platform.WriteError(w, r, http.StatusForbidden, platform.CodeForbidden, "Insufficient permissions")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func containsRole(roles []string, role string) bool {
+	for _, r := range roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// bearerToken returns the token of an Authorization: Bearer header.
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+// authProxyHandler forwards a request to path of Auth Service and passes
+// its response through. Login and token requests carry no user, so they
+// are not authenticated here.
+func authProxyHandler(upstream *Upstream, path string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var response json.RawMessage
+		var err error
+		if r.Method == http.MethodGet {
+			err = upstream.Get(r.Context(), path, &response)
+		} else {
+			var body json.RawMessage
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				platform.WriteError(w, r, http.StatusBadRequest, platform.CodeInvalidRequest, "Invalid request body")
+				return
+			}
+			err = upstream.Post(r.Context(), path, body, &response)
+		}
+		if err != nil {
+			logUpstreamError(r.Context(), "Auth request failed", err, "path", path)
+			writeUpstreamError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		w.Write(response)
+	}
+}
+
+// setRoleHandler changes the role of a user. Auth Service checks the
+// forwarded role of the caller again.
+func setRoleHandler(upstreams *Upstreams) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body json.RawMessage
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			platform.WriteError(w, r, http.StatusBadRequest, platform.CodeInvalidRequest, "Invalid request body")
+			return
+		}
+
+		path := "/users/" + url.PathEscape(chi.URLParam(r, "username")) + "/role"
+		var response json.RawMessage
+		if err := upstreams.Auth.Put(r.Context(), path, body, &response); err != nil {
+			logUpstreamError(r.Context(), "Failed to change role", err)
+			writeUpstreamError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(response)
+	}
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"platform"
+)
+
+const testSecret = "test-secret"
+
+func signTestToken(t *testing.T, claims platform.Claims) string {
+	t.Helper()
+	token, err := platform.SignHS256(claims, []byte(testSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestRequireAuth(t *testing.T) {
+	verifier, err := newVerifier(Config{JWTSecret: testSecret})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var user *platform.Claims
+	handler := platform.RequestID(requireAuth(verifier)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user = userFromContext(r.Context())
+	})))
+
+	valid := signTestToken(t, platform.Claims{Subject: "user-1", Name: "Анна", ExpiresAt: time.Now().Add(time.Hour).Unix()})
+	expired := signTestToken(t, platform.Claims{Subject: "user-1", ExpiresAt: time.Now().Add(-time.Hour).Unix()})
+
+	tests := []struct {
+		name          string
+		authorization string
+		status        int
+		message       string
+	}{
+		{"valid", "Bearer " + valid, http.StatusOK, ""},
+		{"missing", "", http.StatusUnauthorized, "Authentication required"},
+		{"wrong scheme", "Basic dXNlcjpwYXNz", http.StatusUnauthorized, "Authentication required"},
+		{"expired", "Bearer " + expired, http.StatusUnauthorized, "Token expired"},
+		{"tampered", "Bearer " + valid + "x", http.StatusUnauthorized, "Invalid token"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user = nil
+			req := httptest.NewRequest("POST", "/comment", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.status {
+				t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, tt.status)
+			}
+			if tt.status == http.StatusOK {
+				if user == nil || user.Subject != "user-1" || user.Name != "Анна" {
+					t.Errorf("unexpected user: %+v", user)
+				}
+				return
+			}
+			if user != nil {
+				t.Error("handler called for a rejected request")
+			}
+			if !strings.HasPrefix(rr.Header().Get("WWW-Authenticate"), "Bearer") {
+				t.Errorf("missing WWW-Authenticate header: %q", rr.Header().Get("WWW-Authenticate"))
+			}
+			var response platform.Response
+			if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+				t.Fatalf("could not unmarshal response: %v", err)
+			}
+			if response.Error == nil || response.Error.Code != platform.CodeUnauthorized || response.Error.Message != tt.message {
+				t.Errorf("unexpected error: %+v", response.Error)
+			}
+		})
+	}
+}
+
+func TestRequireAuthWithoutKeys(t *testing.T) {
+	verifier, err := newVerifier(Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := requireAuth(verifier)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("handler called without configured keys")
+	}))
+
+	req := httptest.NewRequest("POST", "/comment", nil)
+	req.Header.Set("Authorization", "Bearer "+signTestToken(t, platform.Claims{Subject: "user-1", ExpiresAt: time.Now().Add(time.Hour).Unix()}))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestCreateCommentForwardsUser(t *testing.T) {
+	censor := newUpstream(t, 0, func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(platform.Response{Status: "success"})
+	})
+	comments := newUpstream(t, 0, func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(platform.GatewaySecretHeader) != "gateway-secret" {
+			t.Errorf("gateway secret not sent: %q", r.Header.Get(platform.GatewaySecretHeader))
+		}
+		user := platform.UserFromHeaders(r.Header)
+		json.NewEncoder(w).Encode(platform.Response{Status: "success", Data: Comment{ID: 1, NewsID: 1, Text: "ok", AuthorID: user.ID, AuthorName: user.Name}})
+	})
+
+	config := Config{
+		NewsAggregatorURL:     newsUpstream(t, 0).URL,
+		CensorServiceURL:      censor.URL,
+		CommentServiceURL:     comments.URL,
+		NewsAggregatorTimeout: time.Second,
+		CensorServiceTimeout:  time.Second,
+		CommentServiceTimeout: time.Second,
+		JWTSecret:             testSecret,
+		GatewaySecret:         "gateway-secret",
+	}
+	verifier, err := newVerifier(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := requireAuth(verifier)(createCommentHandler(NewUpstreams(config)))
+
+	req := httptest.NewRequest("POST", "/comment", strings.NewReader(`{"news_id": 1, "text": "hello"}`))
+	req.Header.Set("Authorization", "Bearer "+signTestToken(t, platform.Claims{Subject: "user-1", Name: "Анна", ExpiresAt: time.Now().Add(time.Hour).Unix()}))
+	// Clients cannot impersonate another user with the internal headers.
+	req.Header.Set(platform.UserIDHeader, "admin")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v: %s", rr.Code, http.StatusOK, rr.Body)
+	}
+	var response struct {
+		Data Comment `json:"data"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("could not unmarshal response: %v", err)
+	}
+	if response.Data.AuthorID != "user-1" || response.Data.AuthorName != "Анна" {
+		t.Errorf("user not forwarded: %+v", response.Data)
+	}
+}
+
+func TestAuthProxyHandler(t *testing.T) {
+	auth := newUpstream(t, 0, func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]string
+		json.NewDecoder(r.Body).Decode(&req)
+		if req["username"] == "taken" {
+			platform.WriteError(w, r, http.StatusConflict, platform.CodeConflict, "Username is already taken")
+			return
+		}
+		json.NewEncoder(w).Encode(platform.Response{Status: "success", Data: map[string]string{"username": req["username"]}})
+	})
+	upstreams := NewUpstreams(Config{AuthServiceURL: auth.URL, AuthServiceTimeout: time.Second})
+	handler := authProxyHandler(upstreams.Auth, "/register")
+
+	req := httptest.NewRequest("POST", "/auth/register", strings.NewReader(`{"username": "anna", "password": "correct horse"}`))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"username":"anna"`) {
+		t.Errorf("unexpected response %d: %s", rr.Code, rr.Body)
+	}
+
+	req = httptest.NewRequest("POST", "/auth/register", strings.NewReader(`{"username": "taken", "password": "correct horse"}`))
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	var response platform.Response
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("could not unmarshal response: %v", err)
+	}
+	if rr.Code != http.StatusConflict || response.Error == nil || response.Error.Code != platform.CodeConflict {
+		t.Errorf("conflict not passed through: %d %+v", rr.Code, response.Error)
+	}
+}
+
+func TestRequireRole(t *testing.T) {
+	verifier, err := newVerifier(Config{JWTSecret: testSecret})
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := requireAuth(verifier)(requireRole(platform.RoleAdmin)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+
+	for _, tt := range []struct {
+		role   string
+		status int
+	}{
+		{"", http.StatusForbidden},
+		{platform.RoleModerator, http.StatusForbidden},
+		{platform.RoleAdmin, http.StatusOK},
+	} {
+		req := httptest.NewRequest("PUT", "/auth/users/anna/role", nil)
+		req.Header.Set("Authorization", "Bearer "+signTestToken(t, platform.Claims{Subject: "user-1", Role: tt.role, ExpiresAt: time.Now().Add(time.Hour).Unix()}))
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != tt.status {
+			t.Errorf("role %q: got status %v want %v", tt.role, rr.Code, tt.status)
+		}
+	}
+}
+
+func TestDeleteCommentForwardsRole(t *testing.T) {
+	var forwarded platform.User
+	comments := newUpstream(t, 0, func(w http.ResponseWriter, r *http.Request) {
+		forwarded = platform.UserFromHeaders(r.Header)
+		if r.Method != http.MethodDelete || r.URL.Path != "/comments/7" || r.URL.RawQuery != "cascade=true" {
+			t.Errorf("unexpected upstream request %s %s", r.Method, r.URL)
+		}
+		platform.WriteError(w, r, http.StatusForbidden, platform.CodeForbidden, "Only the author or a moderator can delete this comment")
+	})
+	config := Config{CommentServiceURL: comments.URL, CommentServiceTimeout: time.Second, JWTSecret: testSecret}
+	verifier, err := newVerifier(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := chi.NewRouter()
+	r.With(requireAuth(verifier)).Delete("/comment/{id}", deleteCommentHandler(NewUpstreams(config)))
+
+	req := httptest.NewRequest("DELETE", "/comment/7?cascade=true", nil)
+	req.Header.Set("Authorization", "Bearer "+signTestToken(t, platform.Claims{Subject: "user-1", Role: platform.RoleModerator, ExpiresAt: time.Now().Add(time.Hour).Unix()}))
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+
+	if forwarded.ID != "user-1" || forwarded.Role != platform.RoleModerator {
+		t.Errorf("user not forwarded: %+v", forwarded)
+	}
+	if rr.Code != http.StatusForbidden || !strings.Contains(rr.Body.String(), platform.CodeForbidden) {
+		t.Errorf("forbidden not passed through: %d %s", rr.Code, rr.Body)
+	}
+}
+
+func TestEditCommentChecksCensor(t *testing.T) {
+	censor := newUpstream(t, 0, func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]string
+		json.NewDecoder(r.Body).Decode(&req)
+		if strings.Contains(req["text"], "qwerty") {
+			platform.WriteError(w, r, http.StatusBadRequest, platform.CodeProhibitedContent, "Comment contains prohibited content")
+			return
+		}
+		json.NewEncoder(w).Encode(platform.Response{Status: "success"})
+	})
+	var edits int
+	comments := newUpstream(t, 0, func(w http.ResponseWriter, r *http.Request) {
+		edits++
+		if r.Method != http.MethodPatch || r.URL.Path != "/comments/7" || platform.UserFromHeaders(r.Header).ID != "user-1" {
+			t.Errorf("unexpected upstream request %s %s %+v", r.Method, r.URL.Path, platform.UserFromHeaders(r.Header))
+		}
+		json.NewEncoder(w).Encode(platform.Response{Status: "success", Data: Comment{ID: 7, Text: "fixed", EditedAt: "2026-01-01T00:00:00Z"}})
+	})
+	config := Config{
+		CensorServiceURL:      censor.URL,
+		CommentServiceURL:     comments.URL,
+		CensorServiceTimeout:  time.Second,
+		CommentServiceTimeout: time.Second,
+		JWTSecret:             testSecret,
+	}
+	verifier, err := newVerifier(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := chi.NewRouter()
+	r.With(requireAuth(verifier)).Patch("/comment/{id}", editCommentHandler(NewUpstreams(config)))
+	token := signTestToken(t, platform.Claims{Subject: "user-1", ExpiresAt: time.Now().Add(time.Hour).Unix()})
+
+	for _, tt := range []struct {
+		text   string
+		status int
+	}{
+		{"qwerty", http.StatusBadRequest},
+		{"fixed", http.StatusOK},
+	} {
+		req := httptest.NewRequest("PATCH", "/comment/7", strings.NewReader(`{"text": "`+tt.text+`"}`))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		if rr.Code != tt.status {
+			t.Errorf("%q: got status %d want %d: %s", tt.text, rr.Code, tt.status, rr.Body)
+		}
+	}
+	if edits != 1 {
+		t.Errorf("comment edited %d times, the prohibited text should not be saved", edits)
+	}
+}
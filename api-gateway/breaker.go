@@ -0,0 +1,123 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var errCircuitOpen = errors.New("circuit breaker is open")
+
+type breakerState int
+
+const (
+	// stateClosed lets every call through.
+	stateClosed breakerState = iota
+	// stateOpen rejects calls until the cooldown has passed.
+	stateOpen
+	// stateHalfOpen lets a single probe through to decide whether to
+	// close or reopen.
+	stateHalfOpen
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case stateOpen:
+		return "open"
+	case stateHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// CircuitBreaker stops calling an upstream after consecutive failures and
+// probes it again once a cooldown has passed.
+type CircuitBreaker struct {
+	mutex     sync.Mutex
+	state     breakerState
+	failures  int
+	openedAt  time.Time
+	probing   bool
+	threshold int
+	cooldown  time.Duration
+	// now is replaced in tests.
+	now func() time.Time
+}
+
+// NewCircuitBreaker returns a breaker that opens after threshold
+// consecutive failures. A zero threshold never opens.
+func NewCircuitBreaker(threshold int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		now:       time.Now,
+	}
+}
+
+// Allow reports whether a call may proceed. Every allowed call must be
+// followed by Record or Release.
+func (b *CircuitBreaker) Allow() error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	switch b.state {
+	case stateOpen:
+		if b.now().Sub(b.openedAt) < b.cooldown {
+			return errCircuitOpen
+		}
+		b.state = stateHalfOpen
+		b.probing = true
+		return nil
+	case stateHalfOpen:
+		if b.probing {
+			return errCircuitOpen
+		}
+		b.probing = true
+		return nil
+	default:
+		return nil
+	}
+}
+
+// Record reports the outcome of an allowed call.
+func (b *CircuitBreaker) Record(success bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if success {
+		b.state = stateClosed
+		b.failures = 0
+		b.probing = false
+		return
+	}
+
+	b.failures++
+	if b.state == stateHalfOpen || (b.threshold > 0 && b.failures >= b.threshold) {
+		b.state = stateOpen
+		b.openedAt = b.now()
+		b.probing = false
+	}
+}
+
+// Release ends an allowed call whose outcome says nothing about the
+// upstream, such as one cancelled by the client. It only frees the probe
+// of a half-open breaker for the next call.
+func (b *CircuitBreaker) Release() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.probing = false
+}
+
+// State returns the current state, reporting an open breaker whose
+// cooldown has passed as half-open.
+func (b *CircuitBreaker) State() breakerState {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.state == stateOpen && b.now().Sub(b.openedAt) >= b.cooldown {
+		return stateHalfOpen
+	}
+	return b.state
+}
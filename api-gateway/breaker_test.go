@@ -0,0 +1,113 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Now()
+	breaker := NewCircuitBreaker(3, 10*time.Second)
+	breaker.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if err := breaker.Allow(); err != nil {
+			t.Fatalf("closed breaker rejected call %d", i)
+		}
+		breaker.Record(false)
+	}
+	if breaker.State() != stateClosed {
+		t.Fatalf("breaker opened before threshold: %v", breaker.State())
+	}
+
+	breaker.Allow()
+	breaker.Record(false)
+	if breaker.State() != stateOpen {
+		t.Fatalf("expected open breaker after threshold, got %v", breaker.State())
+	}
+	if err := breaker.Allow(); err != errCircuitOpen {
+		t.Errorf("open breaker allowed a call: %v", err)
+	}
+
+	// After the cooldown a single probe is let through.
+	now = now.Add(10 * time.Second)
+	if breaker.State() != stateHalfOpen {
+		t.Errorf("expected half-open breaker after cooldown, got %v", breaker.State())
+	}
+	if err := breaker.Allow(); err != nil {
+		t.Fatalf("half-open breaker rejected the probe: %v", err)
+	}
+	if err := breaker.Allow(); err != errCircuitOpen {
+		t.Errorf("half-open breaker allowed a second call: %v", err)
+	}
+
+	// A failed probe reopens the breaker for another cooldown.
+	breaker.Record(false)
+	if breaker.State() != stateOpen {
+		t.Fatalf("expected failed probe to reopen, got %v", breaker.State())
+	}
+
+	now = now.Add(10 * time.Second)
+	breaker.Allow()
+	breaker.Record(true)
+	if breaker.State() != stateClosed {
+		t.Errorf("expected successful probe to close, got %v", breaker.State())
+	}
+}
+
+func TestCircuitBreakerSuccessResetsFailures(t *testing.T) {
+	breaker := NewCircuitBreaker(2, time.Second)
+
+	for i := 0; i < 5; i++ {
+		breaker.Allow()
+		breaker.Record(false)
+		breaker.Allow()
+		breaker.Record(true)
+	}
+	if breaker.State() != stateClosed {
+		t.Errorf("non-consecutive failures opened the breaker")
+	}
+}
+
+func TestCircuitBreakerRelease(t *testing.T) {
+	now := time.Now()
+	breaker := NewCircuitBreaker(2, 10*time.Second)
+	breaker.now = func() time.Time { return now }
+
+	// A released call does not reset the consecutive failures.
+	breaker.Allow()
+	breaker.Record(false)
+	breaker.Allow()
+	breaker.Release()
+	breaker.Allow()
+	breaker.Record(false)
+	if breaker.State() != stateOpen {
+		t.Fatalf("expected open breaker after threshold, got %v", breaker.State())
+	}
+
+	// A released probe keeps the breaker half-open for the next one.
+	now = now.Add(10 * time.Second)
+	breaker.Allow()
+	breaker.Release()
+	if breaker.State() != stateHalfOpen {
+		t.Fatalf("released probe changed the state to %v", breaker.State())
+	}
+	if err := breaker.Allow(); err != nil {
+		t.Fatalf("half-open breaker rejected the next probe: %v", err)
+	}
+	breaker.Record(false)
+	if breaker.State() != stateOpen {
+		t.Errorf("expected failed probe to reopen, got %v", breaker.State())
+	}
+}
+
+func TestCircuitBreakerZeroThreshold(t *testing.T) {
+	breaker := NewCircuitBreaker(0, time.Second)
+	for i := 0; i < 100; i++ {
+		breaker.Allow()
+		breaker.Record(false)
+	}
+	if breaker.State() != stateClosed {
+		t.Errorf("breaker with zero threshold opened")
+	}
+}
@@ -3,54 +3,81 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
 	"net/http"
-	"os"
-	"os/signal"
+	"net/url"
 	"strconv"
-	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-chi/chi/v5"
-	"github.com/go-chi/chi/v5/middleware"
-	"github.com/google/uuid"
+
+	"platform"
 )
 
-type Config struct {
-	Port             string
-	CommentServiceURL string
-	CensorServiceURL  string
-	NewsAggregatorURL string
-}
+// tracerName names the tracer of the spans started by the service.
+const tracerName = "api-gateway"
 
-type Response struct {
-	Status     string      `json:"status"`
-	Data       interface{} `json:"data,omitempty"`
-	Error      string      `json:"error,omitempty"`
-	Pagination *Pagination `json:"pagination,omitempty"`
+type Config struct {
+	Port                  string
+	CommentServiceURL     string
+	CensorServiceURL      string
+	NewsAggregatorURL     string
+	AuthServiceURL        string
+	CommentServiceTimeout time.Duration
+	CensorServiceTimeout  time.Duration
+	NewsAggregatorTimeout time.Duration
+	AuthServiceTimeout    time.Duration
+	// HealthCacheTTL is how long upstream health probes are reused.
+	HealthCacheTTL time.Duration
+	// MaxRetries is how many times a failed GET to an upstream is retried.
+	MaxRetries int
+	// BreakerThreshold consecutive failures open the circuit breaker of an
+	// upstream for BreakerCooldown.
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+	// JWTSecret verifies HS256 bearer tokens, JWKSFile or JWKSURL RS256
+	// ones. JWTIssuer and JWTAudience are checked when set.
+	JWTSecret   string
+	JWKSFile    string
+	JWKSURL     string
+	JWTIssuer   string
+	JWTAudience string
+	// JWTLeeway tolerates clock skew with the token issuer.
+	JWTLeeway time.Duration
+	// GatewaySecret is shared with the services, which trust the user
+	// headers of a request only along with it.
+	GatewaySecret string
 }
 
-type Pagination struct {
-	Page      int `json:"page"`
-	PageSize  int `json:"page_size"`
-	Total     int `json:"total"`
-	TotalPages int `json:"total_pages"`
+type NewsItem struct {
+	ID               int               `json:"id"`
+	Title            string            `json:"title"`
+	Content          string            `json:"content"`
+	Link             string            `json:"link"`
+	Category         string            `json:"category,omitempty"`
+	Source           string            `json:"source"`
+	PublishedAt      time.Time         `json:"published_at"`
+	AlternateSources []AlternateSource `json:"alternate_sources,omitempty"`
 }
 
-type NewsItem struct {
-	ID      int    `json:"id"`
-	Title   string `json:"title"`
-	Content string `json:"content"`
-	Date    string `json:"date"`
+type AlternateSource struct {
+	Feed string `json:"feed"`
+	Link string `json:"link"`
 }
 
 type Comment struct {
-	ID       int    `json:"id"`
-	NewsID   int    `json:"news_id"`
-	ParentID *int   `json:"parent_id,omitempty"`
-	Text     string `json:"text"`
-	CreatedAt string `json:"created_at"`
+	ID         int    `json:"id"`
+	NewsID     int    `json:"news_id"`
+	ParentID   *int   `json:"parent_id,omitempty"`
+	Text       string `json:"text"`
+	AuthorID   string `json:"author_id,omitempty"`
+	AuthorName string `json:"author_name,omitempty"`
+	CreatedAt  string `json:"created_at"`
+	EditedAt   string `json:"edited_at,omitempty"`
+	DeletedAt  string `json:"deleted_at,omitempty"`
+	ReplyCount int    `json:"reply_count"`
 }
 
 type CommentRequest struct {
@@ -59,120 +86,106 @@ type CommentRequest struct {
 	Text     string `json:"text"`
 }
 
+type EditRequest struct {
+	Text string `json:"text"`
+}
+
 func main() {
+	platform.SetupLogging("api-gateway")
+
 	config := Config{
-		Port:             getEnv("API_GATEWAY_PORT", "8080"),
-		CommentServiceURL: getEnv("COMMENT_SERVICE_URL", "http://comment-service:8081"),
-		CensorServiceURL:  getEnv("CENSOR_SERVICE_URL", "http://censor-service:8082"),
-		NewsAggregatorURL: getEnv("NEWS_AGGREGATOR_URL", "http://news-aggregator:8083"),
+		Port:                  platform.GetEnv("API_GATEWAY_PORT", "8080"),
+		CommentServiceURL:     platform.GetEnv("COMMENT_SERVICE_URL", "http://comment-service:8081"),
+		CensorServiceURL:      platform.GetEnv("CENSOR_SERVICE_URL", "http://censor-service:8082"),
+		NewsAggregatorURL:     platform.GetEnv("NEWS_AGGREGATOR_URL", "http://news-aggregator:8083"),
+		AuthServiceURL:        platform.GetEnv("AUTH_SERVICE_URL", "http://auth-service:8084"),
+		CommentServiceTimeout: platform.GetDurationEnv("COMMENT_SERVICE_TIMEOUT", 3*time.Second),
+		CensorServiceTimeout:  platform.GetDurationEnv("CENSOR_SERVICE_TIMEOUT", 3*time.Second),
+		NewsAggregatorTimeout: platform.GetDurationEnv("NEWS_AGGREGATOR_TIMEOUT", 5*time.Second),
+		AuthServiceTimeout:    platform.GetDurationEnv("AUTH_SERVICE_TIMEOUT", 3*time.Second),
+		HealthCacheTTL:        platform.GetDurationEnv("UPSTREAM_HEALTH_CACHE_TTL", 5*time.Second),
+		MaxRetries:            platform.GetIntEnv("UPSTREAM_MAX_RETRIES", 2),
+		BreakerThreshold:      platform.GetIntEnv("UPSTREAM_BREAKER_THRESHOLD", 5),
+		BreakerCooldown:       platform.GetDurationEnv("UPSTREAM_BREAKER_COOLDOWN", 10*time.Second),
+		JWTSecret:             platform.GetEnv("JWT_SECRET", ""),
+		JWKSFile:              platform.GetEnv("JWT_JWKS_FILE", ""),
+		JWKSURL:               platform.GetEnv("JWT_JWKS_URL", ""),
+		JWTIssuer:             platform.GetEnv("JWT_ISSUER", ""),
+		JWTAudience:           platform.GetEnv("JWT_AUDIENCE", ""),
+		JWTLeeway:             platform.GetDurationEnv("JWT_LEEWAY", 30*time.Second),
+		GatewaySecret:         platform.GetEnv("GATEWAY_SECRET", ""),
 	}
 
-	r := chi.NewRouter()
-
-	// Middleware
-	r.Use(middleware.RequestID)
-	r.Use(middleware.RealIP)
-	r.Use(middleware.Logger)
-	r.Use(middleware.Recoverer)
-	r.Use(requestIDMiddleware)
-	r.Use(loggerMiddleware)
-	r.Use(timeoutMiddleware(30 * time.Second))
-
-	// Routes
-	r.Get("/health", healthHandler)
-	r.Get("/news", getNewsHandler(config))
-	r.Get("/news/{id}", getNewsByIDHandler(config))
-	r.Post("/comment", createCommentHandler(config))
-
-	// Graceful shutdown
-	server := &http.Server{
-		Addr:    ":" + config.Port,
-		Handler: r,
+	flushTraces := platform.SetupTracing("api-gateway")
+	defer flushTraces()
+	upstreams := NewUpstreams(config)
+	verifier, err := newVerifier(config)
+	if err != nil {
+		platform.Fatal("Failed to load JWT keys", "error", err)
 	}
 
-	done := make(chan os.Signal, 1)
-	signal.Notify(done, os.Interrupt)
-	go func() {
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("Server failed to start: %v", err)
-		}
-	}()
-
-	log.Printf("API Gateway starting on port %s", config.Port)
-	<-done
-	log.Println("Server stopped gracefully")
-}
-
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+	server := platform.NewServer("API Gateway", config.Port)
+	// With rather than Use, since the server has registered its health
+	// routes already.
+	r := server.Router.With(timeoutMiddleware(30 * time.Second))
+	for _, check := range upstreams.HealthChecks(config.HealthCacheTTL) {
+		server.AddHealthCheck(check)
 	}
-	return defaultValue
-}
 
-func requestIDMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		requestID := r.Header.Get("X-Request-ID")
-		if requestID == "" {
-			requestID = uuid.New().String()
-		}
-		ctx := context.WithValue(r.Context(), "request_id", requestID)
-		next.ServeHTTP(w, r.WithContext(ctx))
-	})
-}
-
-func loggerMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		start := time.Now()
-		next.ServeHTTP(w, r)
-		log.Printf("[%s] %s %s %s", 
-			r.Context().Value("request_id"), 
-			r.Method, 
-			r.URL.Path, 
-			time.Since(start))
-	})
+	// Routes
+	r.Get("/news", getNewsHandler(upstreams))
+	r.Get("/news/{id}", getNewsByIDHandler(upstreams))
+	r.Get("/news/{id}/comments", getNewsCommentsHandler(upstreams))
+	r.With(requireAuth(verifier)).Post("/comment", createCommentHandler(upstreams))
+	r.With(requireAuth(verifier)).Patch("/comment/{id}", editCommentHandler(upstreams))
+	r.With(requireAuth(verifier), requireRole(platform.RoleModerator, platform.RoleAdmin)).
+		Get("/comment/{id}/revisions", getRevisionsHandler(upstreams))
+	r.With(requireAuth(verifier)).Delete("/comment/{id}", deleteCommentHandler(upstreams))
+	r.With(requireAuth(verifier)).Post("/comment/{id}/restore", restoreCommentHandler(upstreams))
+	r.Post("/auth/register", authProxyHandler(upstreams.Auth, "/register"))
+	r.Post("/auth/login", authProxyHandler(upstreams.Auth, "/login"))
+	r.Post("/auth/refresh", authProxyHandler(upstreams.Auth, "/refresh"))
+	r.Post("/auth/logout", authProxyHandler(upstreams.Auth, "/logout"))
+	r.Get("/auth/.well-known/jwks.json", authProxyHandler(upstreams.Auth, "/.well-known/jwks.json"))
+	r.With(requireAuth(verifier), requireRole(platform.RoleAdmin)).Put("/auth/users/{username}/role", setRoleHandler(upstreams))
+
+	if err := server.Run(); err != nil {
+		platform.Fatal("Server failed to start", "error", err)
+	}
 }
 
 func timeoutMiddleware(timeout time.Duration) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
-		return http.TimeoutHandler(next, timeout, "Request timeout")
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// The body carries the request ID, so the handler is built per
+			// request. TimeoutHandler writes it without a content type.
+			body, _ := json.Marshal(platform.ErrorResponse(r, platform.CodeTimeout, "Request timeout"))
+			w.Header().Set("Content-Type", "application/json")
+			http.TimeoutHandler(next, timeout, string(body)).ServeHTTP(w, r)
+		})
 	}
 }
 
-func healthHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(Response{Status: "ok"})
-}
-
-func getNewsHandler(config Config) http.HandlerFunc {
+func getNewsHandler(upstreams *Upstreams) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
-		if page == 0 {
-			page = 1
-		}
-		pageSize, _ := strconv.Atoi(r.URL.Query().Get("page_size"))
-		if pageSize == 0 {
-			pageSize = 10
+		// Pass listing parameters through, News Aggregator validates them
+		query := url.Values{}
+		for _, key := range []string{"page", "page_size", "after", "search", "sort", "category", "source", "from", "to"} {
+			if value := r.URL.Query().Get(key); value != "" {
+				query.Set(key, value)
+			}
 		}
-		search := r.URL.Query().Get("search")
 
 		// Call News Aggregator service
-		url := fmt.Sprintf("%s/news?page=%d&page_size=%d", config.NewsAggregatorURL, page, pageSize)
-		if search != "" {
-			url += "&search=" + search
+		newsPath := "/news"
+		if len(query) > 0 {
+			newsPath += "?" + query.Encode()
 		}
 
-		client := &http.Client{Timeout: 10 * time.Second}
-		resp, err := client.Get(url)
-		if err != nil {
-			http.Error(w, "Failed to fetch news", http.StatusInternalServerError)
-			return
-		}
-		defer resp.Body.Close()
-
-		var newsResponse Response
-		if err := json.NewDecoder(resp.Body).Decode(&newsResponse); err != nil {
-			http.Error(w, "Failed to decode news response", http.StatusInternalServerError)
+		var newsResponse platform.Response
+		if err := upstreams.News.Get(r.Context(), newsPath, &newsResponse); err != nil {
+			logUpstreamError(r.Context(), "Failed to fetch news", err)
+			writeUpstreamError(w, r, err)
 			return
 		}
 
@@ -181,125 +194,282 @@ func getNewsHandler(config Config) http.HandlerFunc {
 	}
 }
 
-func getNewsByIDHandler(config Config) http.HandlerFunc {
+// NewsDetails is a news item with the first page of its comments.
+// MoreComments links to the next page when there is one. Comments is null
+// and Warning is set when Comment Service could not be reached.
+type NewsDetails struct {
+	News               NewsItem             `json:"news"`
+	Comments           []Comment            `json:"comments"`
+	CommentsPagination *platform.Pagination `json:"comments_pagination,omitempty"`
+	MoreComments       string               `json:"more_comments,omitempty"`
+	Warning            string               `json:"warning,omitempty"`
+	RequestID          string               `json:"request_id"`
+}
+
+// commentsPage is a page of comments as returned by Comment Service.
+type commentsPage struct {
+	Data       []Comment            `json:"data"`
+	Pagination *platform.Pagination `json:"pagination"`
+}
+
+func getNewsByIDHandler(upstreams *Upstreams) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		newsID := chi.URLParam(r, "id")
 		newsIDInt, err := strconv.Atoi(newsID)
 		if err != nil {
-			http.Error(w, "Invalid news ID", http.StatusBadRequest)
+			platform.WriteError(w, r, http.StatusBadRequest, platform.CodeInvalidRequest, "Invalid news ID")
 			return
 		}
 
-		// Fetch news from News Aggregator
-		newsURL := fmt.Sprintf("%s/news/%s", config.NewsAggregatorURL, newsID)
-		client := &http.Client{Timeout: 10 * time.Second}
-		newsResp, err := client.Get(newsURL)
-		if err != nil {
-			http.Error(w, "Failed to fetch news", http.StatusInternalServerError)
+		// Fetch news and comments in parallel. Failing to fetch the news
+		// cancels the comments request, as the result would be discarded.
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+
+		var (
+			wg          sync.WaitGroup
+			newsItem    NewsItem
+			newsErr     error
+			comments    commentsPage
+			commentsErr error
+		)
+
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			newsErr = upstreams.News.Get(ctx, fmt.Sprintf("/news/%d", newsIDInt), &newsItem)
+			if newsErr != nil {
+				cancel()
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			commentsErr = upstreams.Comments.Get(ctx, fmt.Sprintf("/comments?news_id=%d", newsIDInt), &comments)
+		}()
+		wg.Wait()
+
+		if newsErr != nil {
+			logUpstreamError(r.Context(), "Failed to fetch news", newsErr, "news_id", newsIDInt)
+			writeUpstreamError(w, r, newsErr)
 			return
 		}
-		defer newsResp.Body.Close()
 
-		var newsItem NewsItem
-		if err := json.NewDecoder(newsResp.Body).Decode(&newsItem); err != nil {
-			http.Error(w, "Failed to decode news response", http.StatusInternalServerError)
-			return
+		result := NewsDetails{
+			News:      newsItem,
+			RequestID: platform.GetRequestID(r.Context()),
+		}
+		if commentsErr != nil {
+			// Serve the news without comments rather than failing the request
+			logUpstreamError(r.Context(), "Failed to fetch comments", commentsErr, "news_id", newsIDInt)
+			result.Warning = "Comments are temporarily unavailable"
+		} else {
+			result.Comments = comments.Data
+			if result.Comments == nil {
+				result.Comments = []Comment{}
+			}
+			result.CommentsPagination = comments.Pagination
+			if comments.Pagination != nil && comments.Pagination.NextCursor != "" {
+				result.MoreComments = fmt.Sprintf("/news/%d/comments?after=%s", newsIDInt, url.QueryEscape(comments.Pagination.NextCursor))
+			}
 		}
 
-		// Fetch comments for this news
-		commentsURL := fmt.Sprintf("%s/comments?news_id=%d", config.CommentServiceURL, newsIDInt)
-		commentsResp, err := client.Get(commentsURL)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(platform.Response{Status: "success", Data: result})
+	}
+}
+
+// getNewsCommentsHandler lists the comments of a news item. Listing
+// parameters are passed through, Comment Service validates them.
+func getNewsCommentsHandler(upstreams *Upstreams) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		newsID, err := strconv.Atoi(chi.URLParam(r, "id"))
 		if err != nil {
-			http.Error(w, "Failed to fetch comments", http.StatusInternalServerError)
+			platform.WriteError(w, r, http.StatusBadRequest, platform.CodeInvalidRequest, "Invalid news ID")
 			return
 		}
-		defer commentsResp.Body.Close()
 
-		var commentsResponse Response
-		if err := json.NewDecoder(commentsResp.Body).Decode(&commentsResponse); err != nil {
-			http.Error(w, "Failed to decode comments response", http.StatusInternalServerError)
-			return
+		query := url.Values{}
+		query.Set("news_id", strconv.Itoa(newsID))
+		for _, key := range []string{"page", "page_size", "after", "sort"} {
+			if value := r.URL.Query().Get(key); value != "" {
+				query.Set(key, value)
+			}
 		}
 
-		// Combine news and comments
-		result := map[string]interface{}{
-			"news":      newsItem,
-			"comments":  commentsResponse.Data,
-			"request_id": r.Context().Value("request_id"),
+		var commentsResponse platform.Response
+		if err := upstreams.Comments.Get(r.Context(), "/comments?"+query.Encode(), &commentsResponse); err != nil {
+			logUpstreamError(r.Context(), "Failed to fetch comments", err, "news_id", newsID)
+			writeUpstreamError(w, r, err)
+			return
 		}
 
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(Response{Status: "success", Data: result})
+		json.NewEncoder(w).Encode(commentsResponse)
 	}
 }
 
-func createCommentHandler(config Config) http.HandlerFunc {
+func createCommentHandler(upstreams *Upstreams) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var req CommentRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			platform.WriteError(w, r, http.StatusBadRequest, platform.CodeInvalidRequest, "Invalid request body")
 			return
 		}
 
 		// Validate input
 		if req.Text == "" {
-			http.Error(w, "Comment text is required", http.StatusBadRequest)
+			platform.WriteError(w, r, http.StatusBadRequest, platform.CodeInvalidRequest, "Comment text is required")
 			return
 		}
 		if req.NewsID <= 0 {
-			http.Error(w, "Valid news ID is required", http.StatusBadRequest)
+			platform.WriteError(w, r, http.StatusBadRequest, platform.CodeInvalidRequest, "Valid news ID is required")
+			return
+		}
+
+		// Check that the news item exists. Comment Service only knows the
+		// news IDs of existing comments.
+		if err := upstreams.News.Get(r.Context(), fmt.Sprintf("/news/%d", req.NewsID), nil); err != nil {
+			var upstreamErr *UpstreamError
+			if errors.As(err, &upstreamErr) && upstreamErr.StatusCode == http.StatusNotFound {
+				platform.WriteError(w, r, http.StatusBadRequest, platform.CodeInvalidRequest, "News item does not exist")
+				return
+			}
+			logUpstreamError(r.Context(), "Failed to check news", err, "news_id", req.NewsID)
+			writeUpstreamError(w, r, err)
 			return
 		}
 
-		// Check with Censor Service
-		censorURL := config.CensorServiceURL + "/check"
+		// Check with Censor Service. A rejection is passed through to the
+		// client with the reason given by the censor.
 		censorPayload := map[string]string{"text": req.Text}
-		censorPayloadBytes, _ := json.Marshal(censorPayload)
+		if err := upstreams.Censor.Post(r.Context(), "/check", censorPayload, nil); err != nil {
+			logUpstreamError(r.Context(), "Censor check failed", err)
+			writeUpstreamError(w, r, err)
+			return
+		}
 
-		client := &http.Client{Timeout: 10 * time.Second}
-		censorReq, _ := http.NewRequest("POST", censorURL, strings.NewReader(string(censorPayloadBytes)))
-		censorReq.Header.Set("Content-Type", "application/json")
-		censorReq.Header.Set("X-Request-ID", r.Context().Value("request_id").(string))
+		// Forward to Comment Service
+		var commentResponse platform.Response
+		if err := upstreams.Comments.Post(r.Context(), "/comments", req, &commentResponse); err != nil {
+			logUpstreamError(r.Context(), "Failed to save comment", err)
+			writeUpstreamError(w, r, err)
+			return
+		}
 
-		censorResp, err := client.Do(censorReq)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(commentResponse)
+	}
+}
+
+// editCommentHandler changes the text of a comment. The new text is
+// checked by Censor Service like a new comment, Comment Service checks
+// that the user is the author.
+func editCommentHandler(upstreams *Upstreams) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		commentID, err := strconv.Atoi(chi.URLParam(r, "id"))
 		if err != nil {
-			http.Error(w, "Failed to check comment with censor service", http.StatusInternalServerError)
+			platform.WriteError(w, r, http.StatusBadRequest, platform.CodeInvalidRequest, "Invalid comment ID")
 			return
 		}
-		defer censorResp.Body.Close()
 
-		if censorResp.StatusCode != http.StatusOK {
-			http.Error(w, "Comment contains prohibited content", http.StatusBadRequest)
+		var req EditRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			platform.WriteError(w, r, http.StatusBadRequest, platform.CodeInvalidRequest, "Invalid request body")
+			return
+		}
+		if req.Text == "" {
+			platform.WriteError(w, r, http.StatusBadRequest, platform.CodeInvalidRequest, "Comment text is required")
 			return
 		}
 
-		// Forward to Comment Service
-		commentURL := config.CommentServiceURL + "/comments"
-		commentPayloadBytes, _ := json.Marshal(req)
+		censorPayload := map[string]string{"text": req.Text}
+		if err := upstreams.Censor.Post(r.Context(), "/check", censorPayload, nil); err != nil {
+			logUpstreamError(r.Context(), "Censor check failed", err)
+			writeUpstreamError(w, r, err)
+			return
+		}
+
+		var commentResponse platform.Response
+		if err := upstreams.Comments.Patch(r.Context(), fmt.Sprintf("/comments/%d", commentID), req, &commentResponse); err != nil {
+			logUpstreamError(r.Context(), "Failed to edit comment", err, "comment_id", commentID)
+			writeUpstreamError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(commentResponse)
+	}
+}
 
-		commentReq, _ := http.NewRequest("POST", commentURL, strings.NewReader(string(commentPayloadBytes)))
-		commentReq.Header.Set("Content-Type", "application/json")
-		commentReq.Header.Set("X-Request-ID", r.Context().Value("request_id").(string))
+// getRevisionsHandler returns the edit history of a comment to
+// moderators.
+func getRevisionsHandler(upstreams *Upstreams) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		commentID, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			platform.WriteError(w, r, http.StatusBadRequest, platform.CodeInvalidRequest, "Invalid comment ID")
+			return
+		}
+
+		var revisionsResponse platform.Response
+		if err := upstreams.Comments.Get(r.Context(), fmt.Sprintf("/comments/%d/revisions", commentID), &revisionsResponse); err != nil {
+			logUpstreamError(r.Context(), "Failed to fetch revisions", err, "comment_id", commentID)
+			writeUpstreamError(w, r, err)
+			return
+		}
 
-		commentResp, err := client.Do(commentReq)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(revisionsResponse)
+	}
+}
+
+// deleteCommentHandler deletes a comment. Comment Service decides whether
+// the user may delete it: authors their own comments, moderators and
+// admins any comment, and with cascade=true its whole thread.
+func deleteCommentHandler(upstreams *Upstreams) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		commentID, err := strconv.Atoi(chi.URLParam(r, "id"))
 		if err != nil {
-			http.Error(w, "Failed to save comment", http.StatusInternalServerError)
+			platform.WriteError(w, r, http.StatusBadRequest, platform.CodeInvalidRequest, "Invalid comment ID")
 			return
 		}
-		defer commentResp.Body.Close()
 
-		if commentResp.StatusCode != http.StatusOK {
-			http.Error(w, "Failed to save comment", http.StatusInternalServerError)
+		path := fmt.Sprintf("/comments/%d", commentID)
+		if r.URL.Query().Get("cascade") == "true" {
+			path += "?cascade=true"
+		}
+
+		var commentResponse platform.Response
+		if err := upstreams.Comments.Delete(r.Context(), path, &commentResponse); err != nil {
+			logUpstreamError(r.Context(), "Failed to delete comment", err, "comment_id", commentID)
+			writeUpstreamError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(commentResponse)
+	}
+}
+
+// restoreCommentHandler restores a soft-deleted comment. Like deletion it
+// is authorized by Comment Service.
+func restoreCommentHandler(upstreams *Upstreams) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		commentID, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			platform.WriteError(w, r, http.StatusBadRequest, platform.CodeInvalidRequest, "Invalid comment ID")
 			return
 		}
 
-		var commentResponse Response
-		if err := json.NewDecoder(commentResp.Body).Decode(&commentResponse); err != nil {
-			http.Error(w, "Failed to decode comment response", http.StatusInternalServerError)
+		var commentResponse platform.Response
+		path := fmt.Sprintf("/comments/%d/restore", commentID)
+		if err := upstreams.Comments.Post(r.Context(), path, struct{}{}, &commentResponse); err != nil {
+			logUpstreamError(r.Context(), "Failed to restore comment", err, "comment_id", commentID)
+			writeUpstreamError(w, r, err)
 			return
 		}
 
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(commentResponse)
 	}
-}
\ No newline at end of file
+}
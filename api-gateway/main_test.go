@@ -1,56 +1,213 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"platform"
 )
 
-func TestHealthHandler(t *testing.T) {
-	req, err := http.NewRequest("GET", "/health", nil)
-	if err != nil {
-		t.Fatal(err)
-	}
+// newsDetailsResponse mirrors the body of GET /news/{id}.
+type newsDetailsResponse struct {
+	Status string `json:"status"`
+	Data   struct {
+		News               NewsItem             `json:"news"`
+		Comments           []Comment            `json:"comments"`
+		CommentsPagination *platform.Pagination `json:"comments_pagination"`
+		MoreComments       string               `json:"more_comments"`
+		Warning            string               `json:"warning"`
+	} `json:"data"`
+}
 
-	rr := httptest.NewRecorder()
-	handler := http.HandlerFunc(healthHandler)
+func newUpstream(t *testing.T, delay time.Duration, handler http.HandlerFunc) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return
+		}
+		handler(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newsUpstream(t *testing.T, delay time.Duration) *httptest.Server {
+	return newUpstream(t, delay, func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(NewsItem{ID: 1, Title: "Test news"})
+	})
+}
+
+func commentsUpstream(t *testing.T, delay time.Duration) *httptest.Server {
+	return newUpstream(t, delay, func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(platform.Response{
+			Status:     "success",
+			Data:       []Comment{{ID: 1, NewsID: 1, Text: "Test comment"}},
+			Pagination: &platform.Pagination{Page: 1, PageSize: 1, Total: 2, TotalPages: 2, NextCursor: "abc+"},
+		})
+	})
+}
+
+func getNewsDetails(t *testing.T, config Config) (int, newsDetailsResponse) {
+	t.Helper()
+	req := httptest.NewRequest("GET", "/news/1", nil)
+	routeContext := chi.NewRouteContext()
+	routeContext.URLParams.Add("id", "1")
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, routeContext))
 
-	handler.ServeHTTP(rr, req)
+	rr := httptest.NewRecorder()
+	getNewsByIDHandler(NewUpstreams(config)).ServeHTTP(rr, req)
 
-	if status := rr.Code; status != http.StatusOK {
-		t.Errorf("handler returned wrong status code: got %v want %v",
-			status, http.StatusOK)
+	var response newsDetailsResponse
+	if rr.Code == http.StatusOK {
+		if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+			t.Fatalf("could not unmarshal response: %v", err)
+		}
 	}
+	return rr.Code, response
+}
 
-	var response Response
-	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
-		t.Errorf("could not unmarshal response: %v", err)
+func TestGetNewsByIDHandler(t *testing.T) {
+	config := Config{
+		NewsAggregatorURL:     newsUpstream(t, 0).URL,
+		CommentServiceURL:     commentsUpstream(t, 0).URL,
+		NewsAggregatorTimeout: time.Second,
+		CommentServiceTimeout: time.Second,
 	}
 
-	if response.Status != "ok" {
-		t.Errorf("handler returned unexpected body: got %v want %v",
-			response.Status, "ok")
+	status, response := getNewsDetails(t, config)
+	if status != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+	if response.Data.News.Title != "Test news" {
+		t.Errorf("unexpected news: %+v", response.Data.News)
+	}
+	if len(response.Data.Comments) != 1 || response.Data.Warning != "" {
+		t.Errorf("unexpected comments %+v, warning %q", response.Data.Comments, response.Data.Warning)
+	}
+	if response.Data.CommentsPagination == nil || response.Data.CommentsPagination.Total != 2 {
+		t.Errorf("unexpected comments pagination %+v", response.Data.CommentsPagination)
+	}
+	if response.Data.MoreComments != "/news/1/comments?after=abc%2B" {
+		t.Errorf("unexpected more comments link %q", response.Data.MoreComments)
 	}
 }
 
-func TestRequestIDMiddleware(t *testing.T) {
-	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		requestID := r.Context().Value("request_id")
-		if requestID == nil {
-			t.Error("request_id not found in context")
+func TestGetNewsCommentsHandler(t *testing.T) {
+	comments := newUpstream(t, 0, func(w http.ResponseWriter, r *http.Request) {
+		if got := r.URL.Query().Encode(); got != "after=abc%2B&news_id=1&sort=newest" {
+			t.Errorf("unexpected upstream query %q", got)
 		}
-		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(platform.Response{Status: "success", Data: []Comment{}})
 	})
+	r := chi.NewRouter()
+	r.Get("/news/{id}/comments", getNewsCommentsHandler(NewUpstreams(Config{CommentServiceURL: comments.URL, CommentServiceTimeout: time.Second})))
 
-	middleware := requestIDMiddleware(nextHandler)
-	req, _ := http.NewRequest("GET", "/", nil)
+	req := httptest.NewRequest("GET", "/news/1/comments?after=abc%2B&sort=newest&news_id=2", nil)
 	rr := httptest.NewRecorder()
-	
-	middleware.ServeHTTP(rr, req)
-	
+	r.ServeHTTP(rr, req)
 	if rr.Code != http.StatusOK {
-		t.Errorf("handler returned wrong status code: got %v want %v",
-			rr.Code, http.StatusOK)
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+}
+
+func TestGetNewsByIDHandlerFetchesInParallel(t *testing.T) {
+	delay := 200 * time.Millisecond
+	config := Config{
+		NewsAggregatorURL:     newsUpstream(t, delay).URL,
+		CommentServiceURL:     commentsUpstream(t, delay).URL,
+		NewsAggregatorTimeout: time.Second,
+		CommentServiceTimeout: time.Second,
 	}
-}
\ No newline at end of file
+
+	start := time.Now()
+	status, _ := getNewsDetails(t, config)
+	if status != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+	if elapsed := time.Since(start); elapsed >= 2*delay {
+		t.Errorf("upstreams were called sequentially: took %v", elapsed)
+	}
+}
+
+func TestGetNewsByIDHandlerWithoutComments(t *testing.T) {
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	for name, commentServiceURL := range map[string]string{
+		"unreachable": down.URL,
+		"timeout":     commentsUpstream(t, time.Second).URL,
+	} {
+		t.Run(name, func(t *testing.T) {
+			config := Config{
+				NewsAggregatorURL:     newsUpstream(t, 0).URL,
+				CommentServiceURL:     commentServiceURL,
+				NewsAggregatorTimeout: time.Second,
+				CommentServiceTimeout: 50 * time.Millisecond,
+			}
+
+			status, response := getNewsDetails(t, config)
+			if status != http.StatusOK {
+				t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+			}
+			if response.Data.News.ID != 1 {
+				t.Errorf("unexpected news: %+v", response.Data.News)
+			}
+			if response.Data.Comments != nil {
+				t.Errorf("expected null comments, got %+v", response.Data.Comments)
+			}
+			if response.Data.Warning == "" {
+				t.Error("expected a warning")
+			}
+		})
+	}
+}
+
+func TestGetNewsByIDHandlerNewsUnavailable(t *testing.T) {
+	config := Config{
+		NewsAggregatorURL:     newUpstream(t, 0, func(w http.ResponseWriter, r *http.Request) { http.Error(w, "boom", http.StatusInternalServerError) }).URL,
+		CommentServiceURL:     commentsUpstream(t, 0).URL,
+		NewsAggregatorTimeout: time.Second,
+		CommentServiceTimeout: time.Second,
+	}
+
+	if status, _ := getNewsDetails(t, config); status == http.StatusOK {
+		t.Errorf("expected an error status, got %v", status)
+	}
+}
+
+func TestTimeoutMiddleware(t *testing.T) {
+	slow := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	})
+	handler := platform.RequestID(timeoutMiddleware(10 * time.Millisecond)(slow))
+
+	for _, id := range []string{"req-1", "req-2"} {
+		req := httptest.NewRequest("GET", "/news", nil)
+		req.Header.Set(platform.RequestIDHeader, id)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusServiceUnavailable {
+			t.Fatalf("wrong status code: got %v want %v", rr.Code, http.StatusServiceUnavailable)
+		}
+		if ct := rr.Header().Get("Content-Type"); ct != "application/json" {
+			t.Errorf("unexpected content type %q", ct)
+		}
+		var response platform.Response
+		if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+			t.Fatalf("could not unmarshal response: %v", err)
+		}
+		want := platform.Error{Code: platform.CodeTimeout, Message: "Request timeout", RequestID: id}
+		if response.Error == nil || *response.Error != want {
+			t.Errorf("unexpected error: got %+v want %+v", response.Error, want)
+		}
+	}
+}
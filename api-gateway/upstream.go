@@ -0,0 +1,461 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"platform"
+)
+
+// Upstream service names used in errors and logs.
+const (
+	newsAggregatorService = "news-aggregator"
+	commentService        = "comment-service"
+	censorService         = "censor-service"
+	authService           = "auth-service"
+)
+
+// maxErrorBodySize caps how much of an upstream error body is kept.
+const maxErrorBodySize = 64 << 10
+
+var (
+	upstreamRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "gateway_upstream_request_duration_seconds",
+		Help:    "Latency of calls to upstream services by upstream, method and outcome.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"upstream", "method", "outcome"})
+	upstreamRejected = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gateway_upstream_rejected_total",
+		Help: "Calls to upstream services rejected by an open circuit breaker.",
+	}, []string{"upstream"})
+)
+
+// exportBreakerState reports the state of breaker under the upstream name.
+// An upstream created again with the same name replaces the gauge of the
+// previous one.
+func exportBreakerState(name string, breaker *CircuitBreaker) {
+	gauge := prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name:        "gateway_upstream_circuit_breaker_state",
+		Help:        "Circuit breaker state by upstream: 0 closed, 1 open, 2 half-open.",
+		ConstLabels: prometheus.Labels{"upstream": name},
+	}, func() float64 { return float64(breaker.State()) })
+
+	err := prometheus.Register(gauge)
+	var registered prometheus.AlreadyRegisteredError
+	if errors.As(err, &registered) {
+		prometheus.Unregister(registered.ExistingCollector)
+		err = prometheus.Register(gauge)
+	}
+	if err != nil {
+		panic(err)
+	}
+}
+
+// UpstreamError describes a failed call to a downstream service.
+type UpstreamError struct {
+	Service string
+	// StatusCode is the upstream response status, zero when no response
+	// was received.
+	StatusCode int
+	// Code and Message are the error reported by the upstream, if any.
+	Code    string
+	Message string
+	Err     error
+}
+
+func (e *UpstreamError) Error() string {
+	switch {
+	case e.StatusCode == 0:
+		return fmt.Sprintf("%s: %v", e.Service, e.Err)
+	case e.Err != nil:
+		return fmt.Sprintf("%s: status %d: %v", e.Service, e.StatusCode, e.Err)
+	default:
+		return fmt.Sprintf("%s: status %d: %s", e.Service, e.StatusCode, e.Message)
+	}
+}
+
+func (e *UpstreamError) Unwrap() error {
+	return e.Err
+}
+
+// Timeout reports whether the upstream did not answer in time.
+func (e *UpstreamError) Timeout() bool {
+	var netErr net.Error
+	return errors.Is(e.Err, context.DeadlineExceeded) || (errors.As(e.Err, &netErr) && netErr.Timeout())
+}
+
+// Unavailable reports whether the upstream failed rather than rejected the
+// request: it could not be reached, answered with a 5xx or sent a response
+// that could not be read.
+func (e *UpstreamError) Unavailable() bool {
+	return e.StatusCode == 0 || e.StatusCode >= 500 || e.Err != nil
+}
+
+// GatewayStatus is the status the gateway answers with. Client errors are
+// passed through, upstream failures become 502, 503 or 504.
+func (e *UpstreamError) GatewayStatus() int {
+	switch {
+	case e.Timeout() || e.StatusCode == http.StatusGatewayTimeout:
+		return http.StatusGatewayTimeout
+	case e.StatusCode == http.StatusServiceUnavailable || errors.Is(e.Err, errCircuitOpen):
+		return http.StatusServiceUnavailable
+	case e.Unavailable():
+		return http.StatusBadGateway
+	default:
+		return e.StatusCode
+	}
+}
+
+// ClientCode is the error code returned to the client. Codes reported by
+// the upstream for client errors are preserved.
+func (e *UpstreamError) ClientCode() string {
+	if e.Code != "" && !e.Unavailable() {
+		return e.Code
+	}
+	return platform.CodeForStatus(e.GatewayStatus())
+}
+
+// ClientMessage is the error text returned to the client. Upstream error
+// bodies are preserved, failures without one get a generic message.
+func (e *UpstreamError) ClientMessage() string {
+	if e.Message != "" && e.Err == nil {
+		return e.Message
+	}
+	if e.Timeout() {
+		return e.Service + " timed out"
+	}
+	return e.Service + " is unavailable"
+}
+
+// writeUpstreamError answers the client according to an upstream failure.
+func writeUpstreamError(w http.ResponseWriter, r *http.Request, err error) {
+	var upstreamErr *UpstreamError
+	if !errors.As(err, &upstreamErr) {
+		platform.WriteError(w, r, http.StatusBadGateway, platform.CodeUpstreamUnavailable, err.Error())
+		return
+	}
+	platform.WriteError(w, r, upstreamErr.GatewayStatus(), upstreamErr.ClientCode(), upstreamErr.ClientMessage())
+}
+
+// logUpstreamError logs a failed upstream call with the request logger of
+// ctx. Requests rejected by the upstream are logged as warnings, upstream
+// failures as errors.
+func logUpstreamError(ctx context.Context, msg string, err error, args ...interface{}) {
+	level := slog.LevelError
+	var upstreamErr *UpstreamError
+	if errors.As(err, &upstreamErr) {
+		args = append(args, "upstream", upstreamErr.Service)
+		if upstreamErr.StatusCode != 0 {
+			args = append(args, "upstream_status", upstreamErr.StatusCode)
+		}
+		if !upstreamErr.Unavailable() {
+			level = slog.LevelWarn
+		}
+	}
+	args = append(args, "error", err)
+	platform.Log(ctx).Log(ctx, level, msg, args...)
+}
+
+// Upstream is a downstream service called by the gateway. Each upstream
+// has its own pooled client and circuit breaker.
+type Upstream struct {
+	Name    string
+	BaseURL string
+	// Timeout bounds a single attempt.
+	Timeout time.Duration
+	// MaxRetries is how many times an idempotent call is retried after
+	// the upstream failed.
+	MaxRetries int
+	// RetryBackoff is the base delay before a retry, doubled after each
+	// attempt and jittered.
+	RetryBackoff time.Duration
+	// GatewaySecret is sent along with the user headers so that the
+	// upstream trusts them.
+	GatewaySecret string
+
+	client  *http.Client
+	breaker *CircuitBreaker
+}
+
+// Upstreams are the services the gateway talks to.
+type Upstreams struct {
+	News     *Upstream
+	Comments *Upstream
+	Censor   *Upstream
+	Auth     *Upstream
+}
+
+// NewUpstreams builds the upstreams described by config.
+func NewUpstreams(config Config) *Upstreams {
+	newUpstream := func(name, baseURL string, timeout time.Duration) *Upstream {
+		u := NewUpstream(name, baseURL, timeout, NewCircuitBreaker(config.BreakerThreshold, config.BreakerCooldown))
+		u.MaxRetries = config.MaxRetries
+		u.GatewaySecret = config.GatewaySecret
+		return u
+	}
+	return &Upstreams{
+		News:     newUpstream(newsAggregatorService, config.NewsAggregatorURL, config.NewsAggregatorTimeout),
+		Comments: newUpstream(commentService, config.CommentServiceURL, config.CommentServiceTimeout),
+		Censor:   newUpstream(censorService, config.CensorServiceURL, config.CensorServiceTimeout),
+		Auth:     newUpstream(authService, config.AuthServiceURL, config.AuthServiceTimeout),
+	}
+}
+
+// NewUpstream returns an upstream with its own connection pool. The state
+// of breaker is exported in metrics under name.
+func NewUpstream(name, baseURL string, timeout time.Duration, breaker *CircuitBreaker) *Upstream {
+	exportBreakerState(name, breaker)
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConns = 100
+	transport.MaxIdleConnsPerHost = 32
+	transport.IdleConnTimeout = 90 * time.Second
+
+	return &Upstream{
+		Name:         name,
+		BaseURL:      baseURL,
+		Timeout:      timeout,
+		RetryBackoff: 50 * time.Millisecond,
+		client:       &http.Client{Transport: transport},
+		breaker:      breaker,
+	}
+}
+
+// Get fetches path and decodes the JSON body into v. Failures are retried
+// up to MaxRetries times.
+func (u *Upstream) Get(ctx context.Context, path string, v interface{}) error {
+	var err error
+	for attempt := 0; ; attempt++ {
+		err = u.do(ctx, http.MethodGet, path, nil, v)
+		if attempt >= u.MaxRetries || !retryable(err) {
+			return err
+		}
+
+		// Full jitter: sleep a random duration up to the exponential
+		// backoff so retries from concurrent requests spread out.
+		backoff := u.RetryBackoff << attempt
+		delay := time.Duration(rand.Int63n(int64(backoff) + 1))
+		platform.Log(ctx).Warn("Retrying upstream call",
+			"upstream", u.Name, "path", path, "attempt", attempt+1, "delay", delay.String(), "error", err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+	}
+}
+
+// Post sends payload as JSON to path and decodes the response into v. It
+// is not retried as it may not be idempotent.
+func (u *Upstream) Post(ctx context.Context, path string, payload, v interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return u.do(ctx, http.MethodPost, path, body, v)
+}
+
+// Put sends payload as JSON to path and decodes the response into v. Like
+// Post it is not retried.
+func (u *Upstream) Put(ctx context.Context, path string, payload, v interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return u.do(ctx, http.MethodPut, path, body, v)
+}
+
+// Patch sends payload as JSON to path and decodes the response into v.
+// Like Post it is not retried.
+func (u *Upstream) Patch(ctx context.Context, path string, payload, v interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return u.do(ctx, http.MethodPatch, path, body, v)
+}
+
+// Delete deletes path and decodes the response into v. It is not retried:
+// a retry after a delete that succeeded but timed out would fail with 404.
+func (u *Upstream) Delete(ctx context.Context, path string, v interface{}) error {
+	return u.do(ctx, http.MethodDelete, path, nil, v)
+}
+
+// outcome labels the result of an upstream call in metrics.
+func outcome(err error) string {
+	var upstreamErr *UpstreamError
+	switch {
+	case err == nil:
+		return "success"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case !errors.As(err, &upstreamErr):
+		return "error"
+	case upstreamErr.Timeout():
+		return "timeout"
+	case upstreamErr.Unavailable():
+		return "unavailable"
+	default:
+		return "client_error"
+	}
+}
+
+// retryable reports whether a failed call may succeed when repeated.
+// Timeouts are not retried so a slow upstream is not given more load, and
+// client errors would fail again.
+func retryable(err error) bool {
+	var upstreamErr *UpstreamError
+	if !errors.As(err, &upstreamErr) {
+		return false
+	}
+	if errors.Is(err, errCircuitOpen) || upstreamErr.Timeout() || errors.Is(err, context.Canceled) {
+		return false
+	}
+	return upstreamErr.Unavailable()
+}
+
+// do makes a single attempt through the circuit breaker, decoding a 2xx
+// JSON body into v. Any other outcome is returned as an *UpstreamError.
+func (u *Upstream) do(ctx context.Context, method, path string, body []byte, v interface{}) error {
+	if err := u.breaker.Allow(); err != nil {
+		upstreamRejected.WithLabelValues(u.Name).Inc()
+		return &UpstreamError{Service: u.Name, Err: err}
+	}
+
+	start := time.Now()
+	err := u.call(ctx, method, path, body, v)
+	upstreamRequestDuration.WithLabelValues(u.Name, method, outcome(err)).Observe(time.Since(start).Seconds())
+
+	// A cancelled call says nothing about the upstream, so it neither
+	// counts as a failure nor closes the breaker.
+	if errors.Is(err, context.Canceled) {
+		u.breaker.Release()
+		return err
+	}
+	// Only failures of the upstream itself count against the breaker, a
+	// 4xx shows that it is up.
+	var upstreamErr *UpstreamError
+	failed := errors.As(err, &upstreamErr) && upstreamErr.Unavailable()
+	u.breaker.Record(!failed)
+	return err
+}
+
+// call makes one HTTP request to the upstream in a client span,
+// propagating the request ID, trace context and authenticated user.
+func (u *Upstream) call(ctx context.Context, method, path string, body []byte, v interface{}) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, u.Timeout)
+	defer cancel()
+
+	ctx, span := otel.Tracer(tracerName).Start(ctx, method+" "+u.Name, trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("peer.service", u.Name),
+			attribute.String("http.method", method),
+			attribute.String("http.url", u.BaseURL+path),
+		))
+	defer func() {
+		platform.RecordError(span, err)
+		span.End()
+	}()
+
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.BaseURL+path, reader)
+	if err != nil {
+		return &UpstreamError{Service: u.Name, Err: err}
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if requestID := platform.GetRequestID(ctx); requestID != "" {
+		req.Header.Set(platform.RequestIDHeader, requestID)
+	}
+	platform.InjectTrace(ctx, req.Header)
+	if claims := userFromContext(ctx); claims != nil {
+		platform.SetUserHeaders(req.Header, claims.User())
+		if u.GatewaySecret != "" {
+			req.Header.Set(platform.GatewaySecretHeader, u.GatewaySecret)
+		}
+	}
+
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return &UpstreamError{Service: u.Name, Err: err}
+	}
+	defer resp.Body.Close()
+	span.SetAttributes(attribute.Int("http.status_code", resp.StatusCode))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+		code, message := parseErrorBody(body)
+		return &UpstreamError{Service: u.Name, StatusCode: resp.StatusCode, Code: code, Message: message}
+	}
+
+	if v == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return &UpstreamError{Service: u.Name, StatusCode: resp.StatusCode, Err: fmt.Errorf("decode response: %w", err)}
+	}
+	return nil
+}
+
+// HealthCheck probes the liveness endpoint of the upstream, caching the
+// result for ttl. An open circuit breaker fails the check without a
+// probe. The breaker state is reported with the result.
+func (u *Upstream) HealthCheck(ttl time.Duration, optional bool) platform.HealthCheck {
+	probe := platform.CachedCheck(platform.HTTPCheck(u.client, u.BaseURL+"/health/live"), ttl)
+	return platform.HealthCheck{
+		Name: u.Name,
+		Check: func(ctx context.Context) error {
+			if u.breaker.State() == stateOpen {
+				return errCircuitOpen
+			}
+			return probe(ctx)
+		},
+		Optional: optional,
+		Details: func() interface{} {
+			return map[string]string{"circuit_breaker": u.breaker.State().String()}
+		},
+	}
+}
+
+// HealthChecks returns the readiness checks of the upstreams. Only News
+// Aggregator is required: without Comment Service news are served without
+// comments, and without Censor Service or Auth Service posting comments or
+// logging in fails on its own.
+func (u *Upstreams) HealthChecks(ttl time.Duration) []platform.HealthCheck {
+	return []platform.HealthCheck{
+		u.News.HealthCheck(ttl, false),
+		u.Comments.HealthCheck(ttl, true),
+		u.Censor.HealthCheck(ttl, true),
+		u.Auth.HealthCheck(ttl, true),
+	}
+}
+
+// parseErrorBody extracts the error from an upstream body: the error of a
+// JSON Response or plain text.
+func parseErrorBody(body []byte) (code, message string) {
+	var response platform.Response
+	if err := json.Unmarshal(body, &response); err == nil && response.Error != nil {
+		return response.Error.Code, response.Error.Message
+	}
+	return "", strings.TrimSpace(string(body))
+}
@@ -0,0 +1,411 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"platform"
+)
+
+func TestUpstreamErrorGatewayStatus(t *testing.T) {
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	tests := []struct {
+		name    string
+		url     string
+		status  int
+		code    string
+		message string
+	}{
+		{
+			name:    "not found",
+			url:     newUpstream(t, 0, func(w http.ResponseWriter, r *http.Request) { http.Error(w, "News not found", http.StatusNotFound) }).URL,
+			status:  http.StatusNotFound,
+			code:    platform.CodeNotFound,
+			message: "News not found",
+		},
+		{
+			name: "json error body",
+			url: newUpstream(t, 0, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(platform.Response{Status: "error", Error: &platform.Error{Code: platform.CodeInvalidRequest, Message: "Invalid after cursor"}})
+			}).URL,
+			status:  http.StatusBadRequest,
+			code:    platform.CodeInvalidRequest,
+			message: "Invalid after cursor",
+		},
+		{
+			name: "server error",
+			url: newUpstream(t, 0, func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "Failed to fetch news", http.StatusInternalServerError)
+			}).URL,
+			status:  http.StatusBadGateway,
+			code:    platform.CodeUpstreamUnavailable,
+			message: "Failed to fetch news",
+		},
+		{
+			name: "service unavailable",
+			url: newUpstream(t, 0, func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "Overloaded", http.StatusServiceUnavailable)
+			}).URL,
+			status:  http.StatusServiceUnavailable,
+			code:    platform.CodeUpstreamUnavailable,
+			message: "Overloaded",
+		},
+		{
+			name:    "invalid body",
+			url:     newUpstream(t, 0, func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("not json")) }).URL,
+			status:  http.StatusBadGateway,
+			code:    platform.CodeUpstreamUnavailable,
+			message: "news-aggregator is unavailable",
+		},
+		{
+			name:    "unreachable",
+			url:     down.URL,
+			status:  http.StatusBadGateway,
+			code:    platform.CodeUpstreamUnavailable,
+			message: "news-aggregator is unavailable",
+		},
+		{
+			name:    "timeout",
+			url:     newsUpstream(t, time.Second).URL,
+			status:  http.StatusGatewayTimeout,
+			code:    platform.CodeUpstreamTimeout,
+			message: "news-aggregator timed out",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var item NewsItem
+			req := httptest.NewRequest("GET", "/", nil)
+			upstream := NewUpstream(newsAggregatorService, tt.url, 50*time.Millisecond, NewCircuitBreaker(0, 0))
+			err := upstream.Get(req.Context(), "", &item)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+
+			rr := httptest.NewRecorder()
+			writeUpstreamError(rr, req, err)
+			if rr.Code != tt.status {
+				t.Errorf("wrong status code: got %v want %v", rr.Code, tt.status)
+			}
+			var response platform.Response
+			if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+				t.Fatalf("could not unmarshal response: %v", err)
+			}
+			if response.Status != "error" || response.Error == nil {
+				t.Fatalf("unexpected response: %+v", response)
+			}
+			if response.Error.Code != tt.code || response.Error.Message != tt.message {
+				t.Errorf("unexpected error: %+v", response.Error)
+			}
+		})
+	}
+}
+
+func TestGetNewsByIDHandlerNotFound(t *testing.T) {
+	config := Config{
+		NewsAggregatorURL:     newUpstream(t, 0, func(w http.ResponseWriter, r *http.Request) { http.Error(w, "News not found", http.StatusNotFound) }).URL,
+		CommentServiceURL:     commentsUpstream(t, 0).URL,
+		NewsAggregatorTimeout: time.Second,
+		CommentServiceTimeout: time.Second,
+	}
+
+	if status, _ := getNewsDetails(t, config); status != http.StatusNotFound {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusNotFound)
+	}
+}
+
+func TestCreateCommentHandlerUpstreamErrors(t *testing.T) {
+	newsOK := newsUpstream(t, 0).URL
+	newsMissing := newUpstream(t, 0, func(w http.ResponseWriter, r *http.Request) {
+		platform.WriteError(w, r, http.StatusNotFound, platform.CodeNotFound, "News not found")
+	}).URL
+	censorOK := newUpstream(t, 0, func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(platform.Response{Status: "success"})
+	}).URL
+	censorRejects := newUpstream(t, 0, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Text contains prohibited content", http.StatusBadRequest)
+	}).URL
+	commentsOK := newUpstream(t, 0, func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(platform.Response{Status: "success", Data: Comment{ID: 1, NewsID: 1, Text: "ok"}})
+	}).URL
+	commentsFail := newUpstream(t, 0, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Failed to save comment", http.StatusInternalServerError)
+	}).URL
+
+	tests := []struct {
+		name        string
+		newsURL     string
+		censorURL   string
+		commentsURL string
+		status      int
+		message     string
+	}{
+		{"saved", newsOK, censorOK, commentsOK, http.StatusOK, ""},
+		{"unknown news", newsMissing, censorOK, commentsOK, http.StatusBadRequest, "News item does not exist"},
+		{"prohibited content", newsOK, censorRejects, commentsOK, http.StatusBadRequest, "Text contains prohibited content"},
+		{"comment service fails", newsOK, censorOK, commentsFail, http.StatusBadGateway, "Failed to save comment"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := Config{
+				NewsAggregatorURL:     tt.newsURL,
+				CensorServiceURL:      tt.censorURL,
+				CommentServiceURL:     tt.commentsURL,
+				NewsAggregatorTimeout: time.Second,
+				CensorServiceTimeout:  time.Second,
+				CommentServiceTimeout: time.Second,
+			}
+			req := httptest.NewRequest("POST", "/comment", strings.NewReader(`{"news_id": 1, "text": "hello"}`))
+			rr := httptest.NewRecorder()
+			createCommentHandler(NewUpstreams(config)).ServeHTTP(rr, req)
+
+			if rr.Code != tt.status {
+				t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, tt.status)
+			}
+			var response platform.Response
+			if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+				t.Fatalf("could not unmarshal response: %v", err)
+			}
+			if tt.message == "" {
+				if response.Error != nil {
+					t.Errorf("unexpected error: %+v", response.Error)
+				}
+				return
+			}
+			if response.Error == nil || response.Error.Message != tt.message {
+				t.Errorf("unexpected error: got %+v want %q", response.Error, tt.message)
+			}
+		})
+	}
+}
+
+func TestUpstreamHealthChecks(t *testing.T) {
+	up := httptest.NewServer(http.HandlerFunc(platform.HealthHandler))
+	defer up.Close()
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	config := Config{
+		NewsAggregatorURL: up.URL,
+		CommentServiceURL: down.URL,
+		CensorServiceURL:  up.URL,
+		AuthServiceURL:    up.URL,
+		HealthCacheTTL:    time.Minute,
+	}
+
+	for _, check := range NewUpstreams(config).HealthChecks(config.HealthCacheTTL) {
+		err := check.Check(context.Background())
+		if wantErr := check.Name == commentService; (err != nil) != wantErr {
+			t.Errorf("%s: unexpected result %v", check.Name, err)
+		}
+		if check.Name == newsAggregatorService && check.Optional {
+			t.Error("news-aggregator must be a required check")
+		}
+	}
+}
+
+func TestUpstreamGetRetries(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		delay   time.Duration
+		calls   int32
+		wantErr bool
+	}{
+		{"recovers after server errors", http.StatusServiceUnavailable, 0, 3, false},
+		{"client errors are not retried", http.StatusNotFound, 0, 1, true},
+		{"timeouts are not retried", http.StatusOK, time.Second, 1, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				// Fail every attempt but the third.
+				attempt := atomic.AddInt32(&calls, 1)
+				select {
+				case <-time.After(tt.delay):
+				case <-r.Context().Done():
+					return
+				}
+				if attempt < 3 {
+					http.Error(w, "failure", tt.status)
+					return
+				}
+				json.NewEncoder(w).Encode(NewsItem{ID: 1})
+			}))
+			t.Cleanup(server.Close)
+
+			upstream := NewUpstream(newsAggregatorService, server.URL, 100*time.Millisecond, NewCircuitBreaker(0, 0))
+			upstream.MaxRetries = 2
+			upstream.RetryBackoff = time.Millisecond
+
+			var item NewsItem
+			err := upstream.Get(context.Background(), "/news/1", &item)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if got := atomic.LoadInt32(&calls); got != tt.calls {
+				t.Errorf("upstream called %d times, want %d", got, tt.calls)
+			}
+		})
+	}
+}
+
+func TestUpstreamPostIsNotRetried(t *testing.T) {
+	var calls int32
+	server := newUpstream(t, 0, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		http.Error(w, "failure", http.StatusServiceUnavailable)
+	})
+
+	upstream := NewUpstream(commentService, server.URL, time.Second, NewCircuitBreaker(0, 0))
+	upstream.MaxRetries = 2
+	if err := upstream.Post(context.Background(), "/comments", map[string]string{}, nil); err == nil {
+		t.Fatal("expected an error")
+	}
+	if calls != 1 {
+		t.Errorf("POST was sent %d times", calls)
+	}
+}
+
+func TestUpstreamCircuitBreaker(t *testing.T) {
+	var calls int32
+	server := newUpstream(t, 0, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		http.Error(w, "failure", http.StatusInternalServerError)
+	})
+
+	upstream := NewUpstream(commentService, server.URL, time.Second, NewCircuitBreaker(2, time.Minute))
+	for i := 0; i < 2; i++ {
+		upstream.Get(context.Background(), "/comments?news_id=1", nil)
+	}
+	if calls != 2 {
+		t.Fatalf("expected 2 calls before the breaker opens, got %d", calls)
+	}
+
+	err := upstream.Get(context.Background(), "/comments?news_id=1", nil)
+	if calls != 2 {
+		t.Errorf("open breaker let a call through")
+	}
+	var upstreamErr *UpstreamError
+	if !errors.As(err, &upstreamErr) || upstreamErr.GatewayStatus() != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 for an open breaker, got %v", err)
+	}
+
+	check := upstream.HealthCheck(time.Minute, true)
+	if err := check.Check(context.Background()); err == nil {
+		t.Error("expected health check to fail with an open breaker")
+	}
+	details, _ := check.Details().(map[string]string)
+	if details["circuit_breaker"] != "open" {
+		t.Errorf("unexpected details: %v", check.Details())
+	}
+}
+
+func TestUpstreamCircuitBreakerIgnoresCancellation(t *testing.T) {
+	var calls int32
+	server := newUpstream(t, 0, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		http.Error(w, "failure", http.StatusInternalServerError)
+	})
+
+	breaker := NewCircuitBreaker(2, time.Minute)
+	upstream := NewUpstream(commentService, server.URL, time.Second, breaker)
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// A cancelled call between two failures does not reset the count.
+	upstream.Post(context.Background(), "/comments", struct{}{}, nil)
+	if err := upstream.Post(cancelled, "/comments", struct{}{}, nil); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected a cancelled call, got %v", err)
+	}
+	upstream.Post(context.Background(), "/comments", struct{}{}, nil)
+	if breaker.State() != stateOpen {
+		t.Errorf("expected open breaker, got %v", breaker.State())
+	}
+	if calls != 2 {
+		t.Errorf("expected 2 calls to reach the upstream, got %d", calls)
+	}
+}
+
+func TestUpstreamMetrics(t *testing.T) {
+	server := newUpstream(t, 0, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "News not found", http.StatusNotFound)
+	})
+	upstream := NewUpstream("metrics-test", server.URL, time.Second, NewCircuitBreaker(1, time.Minute))
+	upstream.Get(context.Background(), "/news/1", nil)
+
+	rr := httptest.NewRecorder()
+	promhttp.Handler().ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+	body := rr.Body.String()
+	for _, line := range []string{
+		`gateway_upstream_request_duration_seconds_count{method="GET",outcome="client_error",upstream="metrics-test"} 1`,
+		`gateway_upstream_circuit_breaker_state{upstream="metrics-test"} 0`,
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("metrics missing %q", line)
+		}
+	}
+}
+
+func TestUpstreamPropagatesTrace(t *testing.T) {
+	headers := make(chan http.Header, 2)
+	server := newUpstream(t, 0, func(w http.ResponseWriter, r *http.Request) {
+		headers <- r.Header.Clone()
+		json.NewEncoder(w).Encode(NewsItem{ID: 1})
+	})
+	upstream := NewUpstream(newsAggregatorService, server.URL, time.Second, NewCircuitBreaker(0, 0))
+
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer otel.SetTracerProvider(previous)
+
+	ctx, span := otel.Tracer("test").Start(platform.WithRequestID(context.Background(), "req-1"), "GET /news/{id}")
+	defer span.End()
+	if err := upstream.Get(ctx, "/news/1", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := upstream.Post(ctx, "/news", map[string]string{}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, method := range []string{"GET", "POST"} {
+		header := <-headers
+		if header.Get("X-Request-ID") != "req-1" {
+			t.Errorf("%s: X-Request-ID not forwarded: %q", method, header.Get("X-Request-ID"))
+		}
+		sc := trace.SpanContextFromContext(propagation.TraceContext{}.Extract(context.Background(), propagation.HeaderCarrier(header)))
+		if !sc.IsValid() || sc.TraceID() != span.SpanContext().TraceID() || sc.SpanID() == span.SpanContext().SpanID() {
+			t.Errorf("%s: unexpected traceparent %q", method, header.Get("traceparent"))
+		}
+	}
+	for _, client := range recorder.Ended() {
+		if client.SpanKind() != trace.SpanKindClient || client.Parent().SpanID() != span.SpanContext().SpanID() {
+			t.Errorf("unexpected upstream span %q: %+v", client.Name(), client.Parent())
+		}
+	}
+	if len(recorder.Ended()) != 2 {
+		t.Errorf("expected 2 upstream spans, got %d", len(recorder.Ended()))
+	}
+}
@@ -0,0 +1,381 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"platform"
+)
+
+// tracerName names the tracer of the spans started by the service.
+const tracerName = "auth-service"
+
+type Config struct {
+	Port   string
+	DBPath string
+	// SigningKeyFile is a PEM RSA private key for RS256 tokens. JWTSecret
+	// signs HS256 tokens when no key file is set.
+	SigningKeyFile string
+	JWTSecret      string
+	Issuer         string
+	Audience       string
+	AccessTTL      time.Duration
+	RefreshTTL     time.Duration
+	// Admins are existing accounts given the admin role at startup, to
+	// bootstrap role management. Registration never grants it.
+	Admins []string
+	// GatewaySecret authenticates the user headers set by the gateway.
+	GatewaySecret string
+}
+
+var (
+	authRegistrations = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "auth_registrations_total",
+		Help: "Registered users.",
+	})
+	authLogins = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "auth_logins_total",
+		Help: "Login attempts by result: success or failure.",
+	}, []string{"result"})
+	authRefreshes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "auth_refreshes_total",
+		Help: "Refresh token exchanges by result: success, invalid or reused.",
+	}, []string{"result"})
+)
+
+const (
+	minPasswordLength = 8
+	maxPasswordLength = 128
+	maxNameLength     = 64
+)
+
+var usernamePattern = regexp.MustCompile(`^[a-z0-9_.-]{3,32}$`)
+
+type RegisterRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Name     string `json:"name"`
+}
+
+type LoginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token"`
+	// All revokes every session of the user instead of only this one.
+	All bool `json:"all"`
+}
+
+// TokenResponse is returned by login and refresh.
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	// ExpiresIn is the lifetime of the access token in seconds.
+	ExpiresIn int  `json:"expires_in"`
+	User      User `json:"user"`
+}
+
+type AuthService struct {
+	store  *Store
+	tokens *TokenIssuer
+}
+
+type RoleRequest struct {
+	Role string `json:"role"`
+}
+
+func main() {
+	platform.SetupLogging("auth-service")
+
+	config := Config{
+		Port:           platform.GetEnv("AUTH_SERVICE_PORT", "8084"),
+		DBPath:         platform.GetEnv("AUTH_DB_PATH", "./auth.db"),
+		SigningKeyFile: platform.GetEnv("AUTH_SIGNING_KEY_FILE", ""),
+		JWTSecret:      platform.GetEnv("JWT_SECRET", ""),
+		Issuer:         platform.GetEnv("JWT_ISSUER", "auth-service"),
+		Audience:       platform.GetEnv("JWT_AUDIENCE", ""),
+		AccessTTL:      platform.GetDurationEnv("AUTH_ACCESS_TOKEN_TTL", 15*time.Minute),
+		RefreshTTL:     platform.GetDurationEnv("AUTH_REFRESH_TOKEN_TTL", 30*24*time.Hour),
+		Admins:         parseList(platform.GetEnv("AUTH_ADMINS", "")),
+		GatewaySecret:  platform.GetEnv("GATEWAY_SECRET", ""),
+	}
+
+	flushTraces := platform.SetupTracing("auth-service")
+	defer flushTraces()
+
+	tokens, err := newTokenIssuer(config)
+	if err != nil {
+		platform.Fatal("Failed to load signing key", "error", err)
+	}
+
+	db, err := initDB(config.DBPath)
+	if err != nil {
+		platform.Fatal("Failed to initialize database", "error", err)
+	}
+	// Closed after Run returns, once in-flight requests have drained.
+	defer db.Close()
+
+	auth := &AuthService{store: NewStore(db), tokens: tokens}
+	for _, username := range config.Admins {
+		err := auth.store.SetRole(context.Background(), username, platform.RoleAdmin)
+		if err != nil && !errors.Is(err, errUserNotFound) {
+			platform.Fatal("Failed to grant admin role", "username", username, "error", err)
+		}
+	}
+
+	server := platform.NewServer("Auth Service", config.Port)
+	server.AddHealthCheck(platform.HealthCheck{Name: "sqlite", Check: db.PingContext})
+	r := server.Router
+
+	// Routes
+	r.Post("/register", auth.registerHandler)
+	r.Post("/login", auth.loginHandler)
+	r.Post("/refresh", auth.refreshHandler)
+	r.Post("/logout", auth.logoutHandler)
+	r.With(platform.TrustGateway(config.GatewaySecret)).Put("/users/{username}/role", auth.setRoleHandler)
+	r.Get("/.well-known/jwks.json", tokens.jwksHandler)
+
+	if err := server.Run(); err != nil {
+		platform.Fatal("Server failed to start", "error", err)
+	}
+}
+
+func (a *AuthService) registerHandler(w http.ResponseWriter, r *http.Request) {
+	var req RegisterRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		platform.WriteError(w, r, http.StatusBadRequest, platform.CodeInvalidRequest, "Invalid request body")
+		return
+	}
+
+	// Validate input
+	username := strings.ToLower(strings.TrimSpace(req.Username))
+	if !usernamePattern.MatchString(username) {
+		platform.WriteError(w, r, http.StatusBadRequest, platform.CodeInvalidRequest,
+			"Username must be 3 to 32 characters: letters, digits, '_', '.' or '-'")
+		return
+	}
+	if n := utf8.RuneCountInString(req.Password); n < minPasswordLength || n > maxPasswordLength {
+		platform.WriteError(w, r, http.StatusBadRequest, platform.CodeInvalidRequest,
+			"Password must be 8 to 128 characters")
+		return
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		name = username
+	}
+	if utf8.RuneCountInString(name) > maxNameLength {
+		platform.WriteError(w, r, http.StatusBadRequest, platform.CodeInvalidRequest, "Name must be at most 64 characters")
+		return
+	}
+
+	user, err := a.store.CreateUser(r.Context(), username, name, platform.RoleUser, hashPassword(req.Password))
+	if errors.Is(err, errUserExists) {
+		platform.WriteError(w, r, http.StatusConflict, platform.CodeConflict, "Username is already taken")
+		return
+	}
+	if err != nil {
+		platform.Log(r.Context()).Error("Failed to create user", "error", err)
+		platform.WriteError(w, r, http.StatusInternalServerError, platform.CodeInternal, "Failed to create user")
+		return
+	}
+	authRegistrations.Inc()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(platform.Response{
+		Status: "success",
+		Data:   user,
+	})
+}
+
+func (a *AuthService) loginHandler(w http.ResponseWriter, r *http.Request) {
+	var req LoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		platform.WriteError(w, r, http.StatusBadRequest, platform.CodeInvalidRequest, "Invalid request body")
+		return
+	}
+
+	user, err := a.store.UserByUsername(r.Context(), strings.ToLower(strings.TrimSpace(req.Username)))
+	if err != nil && !errors.Is(err, errUserNotFound) {
+		platform.Log(r.Context()).Error("Failed to fetch user", "error", err)
+		platform.WriteError(w, r, http.StatusInternalServerError, platform.CodeInternal, "Failed to fetch user")
+		return
+	}
+
+	// Unknown users are checked against a dummy hash so the response time
+	// does not tell which usernames exist.
+	hash := user.PasswordHash
+	if err != nil {
+		hash = dummyHash
+	}
+	ok, hashErr := checkPassword(req.Password, hash)
+	if hashErr != nil {
+		platform.Log(r.Context()).Error("Failed to check password", "user_id", user.ID, "error", hashErr)
+	}
+	if err != nil || !ok {
+		authLogins.WithLabelValues("failure").Inc()
+		platform.WriteError(w, r, http.StatusUnauthorized, platform.CodeUnauthorized, "Invalid username or password")
+		return
+	}
+	authLogins.WithLabelValues("success").Inc()
+
+	a.writeTokens(w, r, user)
+}
+
+func (a *AuthService) refreshHandler(w http.ResponseWriter, r *http.Request) {
+	var req RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+		platform.WriteError(w, r, http.StatusBadRequest, platform.CodeInvalidRequest, "refresh_token is required")
+		return
+	}
+
+	userID, err := a.store.UseRefreshToken(r.Context(), req.RefreshToken)
+	switch {
+	case errors.Is(err, errTokenReused):
+		authRefreshes.WithLabelValues("reused").Inc()
+		platform.Log(r.Context()).Warn("Revoked refresh token reused, revoking all sessions", "user_id", userID)
+		platform.WriteError(w, r, http.StatusUnauthorized, platform.CodeUnauthorized, "Invalid refresh token")
+		return
+	case errors.Is(err, errTokenUnknown):
+		authRefreshes.WithLabelValues("invalid").Inc()
+		platform.WriteError(w, r, http.StatusUnauthorized, platform.CodeUnauthorized, "Invalid refresh token")
+		return
+	case err != nil:
+		platform.Log(r.Context()).Error("Failed to use refresh token", "error", err)
+		platform.WriteError(w, r, http.StatusInternalServerError, platform.CodeInternal, "Failed to refresh token")
+		return
+	}
+
+	user, err := a.store.UserByID(r.Context(), userID)
+	if err != nil {
+		platform.Log(r.Context()).Error("Failed to fetch user", "user_id", userID, "error", err)
+		platform.WriteError(w, r, http.StatusInternalServerError, platform.CodeInternal, "Failed to fetch user")
+		return
+	}
+	authRefreshes.WithLabelValues("success").Inc()
+
+	a.writeTokens(w, r, user)
+}
+
+func (a *AuthService) logoutHandler(w http.ResponseWriter, r *http.Request) {
+	var req LogoutRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+		platform.WriteError(w, r, http.StatusBadRequest, platform.CodeInvalidRequest, "refresh_token is required")
+		return
+	}
+
+	if err := a.store.RevokeRefreshToken(r.Context(), req.RefreshToken, req.All); err != nil {
+		platform.Log(r.Context()).Error("Failed to revoke refresh token", "error", err)
+		platform.WriteError(w, r, http.StatusInternalServerError, platform.CodeInternal, "Failed to revoke refresh token")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(platform.Response{
+		Status: "success",
+		Data:   map[string]string{"message": "Logged out successfully"},
+	})
+}
+
+// setRoleHandler changes the role of a user. Only admins, as forwarded by
+// the gateway with its secret, may change roles. The new role is in tokens issued after
+// the change.
+func (a *AuthService) setRoleHandler(w http.ResponseWriter, r *http.Request) {
+	caller := platform.UserFromHeaders(r.Header)
+	if caller.ID == "" {
+		platform.WriteError(w, r, http.StatusUnauthorized, platform.CodeUnauthorized, "Authentication required")
+		return
+	}
+	if caller.Role != platform.RoleAdmin {
+		platform.WriteError(w, r, http.StatusForbidden, platform.CodeForbidden, "Only admins can change roles")
+		return
+	}
+
+	var req RoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || !platform.ValidRole(req.Role) {
+		platform.WriteError(w, r, http.StatusBadRequest, platform.CodeInvalidRequest, "role must be user, moderator or admin")
+		return
+	}
+
+	username := strings.ToLower(chi.URLParam(r, "username"))
+	err := a.store.SetRole(r.Context(), username, req.Role)
+	if errors.Is(err, errUserNotFound) {
+		platform.WriteError(w, r, http.StatusNotFound, platform.CodeNotFound, "User not found")
+		return
+	}
+	if err != nil {
+		platform.Log(r.Context()).Error("Failed to change role", "error", err)
+		platform.WriteError(w, r, http.StatusInternalServerError, platform.CodeInternal, "Failed to change role")
+		return
+	}
+	platform.Log(r.Context()).Info("Role changed", "username", username, "role", req.Role, "actor_id", caller.ID)
+
+	user, err := a.store.UserByUsername(r.Context(), username)
+	if err != nil {
+		platform.Log(r.Context()).Error("Failed to fetch user", "error", err)
+		platform.WriteError(w, r, http.StatusInternalServerError, platform.CodeInternal, "Failed to fetch user")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(platform.Response{
+		Status: "success",
+		Data:   user,
+	})
+}
+
+// parseList splits a comma-separated list, dropping empty entries.
+func parseList(value string) []string {
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.ToLower(strings.TrimSpace(item)); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// writeTokens issues a new access and refresh token pair for user.
+func (a *AuthService) writeTokens(w http.ResponseWriter, r *http.Request, user User) {
+	accessToken, err := a.tokens.AccessToken(user)
+	if err != nil {
+		platform.Log(r.Context()).Error("Failed to sign access token", "error", err)
+		platform.WriteError(w, r, http.StatusInternalServerError, platform.CodeInternal, "Failed to issue tokens")
+		return
+	}
+	refreshToken := newRefreshToken()
+	if err := a.store.SaveRefreshToken(r.Context(), refreshToken, user.ID, time.Now().Add(a.tokens.RefreshTTL)); err != nil {
+		platform.Log(r.Context()).Error("Failed to save refresh token", "error", err)
+		platform.WriteError(w, r, http.StatusInternalServerError, platform.CodeInternal, "Failed to issue tokens")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(platform.Response{
+		Status: "success",
+		Data: TokenResponse{
+			AccessToken:  accessToken,
+			RefreshToken: refreshToken,
+			TokenType:    "Bearer",
+			ExpiresIn:    int(a.tokens.AccessTTL.Seconds()),
+			User:         user,
+		},
+	})
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"platform"
+)
+
+func newTestService(t *testing.T) *AuthService {
+	t.Helper()
+	db, err := initDB(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	tokens, err := newTokenIssuer(Config{JWTSecret: "secret", Issuer: "auth-service", AccessTTL: time.Minute, RefreshTTL: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &AuthService{store: NewStore(db), tokens: tokens}
+}
+
+// call runs handler with body and decodes the data of a successful
+// response into v.
+func call(t *testing.T, handler http.HandlerFunc, body string, v interface{}) (int, *platform.Error) {
+	t.Helper()
+	req := httptest.NewRequest("POST", "/", strings.NewReader(body))
+	rr := httptest.NewRecorder()
+	platform.RequestID(handler).ServeHTTP(rr, req)
+
+	var response struct {
+		Data  json.RawMessage `json:"data"`
+		Error *platform.Error `json:"error"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("could not unmarshal response: %v", err)
+	}
+	if v != nil && rr.Code == http.StatusOK {
+		if err := json.Unmarshal(response.Data, v); err != nil {
+			t.Fatalf("could not unmarshal data: %v", err)
+		}
+	}
+	return rr.Code, response.Error
+}
+
+func TestRegister(t *testing.T) {
+	auth := newTestService(t)
+
+	var user User
+	status, _ := call(t, auth.registerHandler, `{"username": "Anna", "password": "correct horse", "name": "Анна"}`, &user)
+	if status != http.StatusOK {
+		t.Fatalf("register: got status %d", status)
+	}
+	if user.ID == "" || user.Username != "anna" || user.Name != "Анна" {
+		t.Errorf("unexpected user: %+v", user)
+	}
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		code   string
+	}{
+		{"taken", `{"username": "anna", "password": "another password"}`, http.StatusConflict, platform.CodeConflict},
+		{"short password", `{"username": "boris", "password": "short"}`, http.StatusBadRequest, platform.CodeInvalidRequest},
+		{"bad username", `{"username": "b o", "password": "long enough"}`, http.StatusBadRequest, platform.CodeInvalidRequest},
+		{"invalid body", `{`, http.StatusBadRequest, platform.CodeInvalidRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, apiErr := call(t, auth.registerHandler, tt.body, nil)
+			if status != tt.status || apiErr == nil || apiErr.Code != tt.code {
+				t.Errorf("got status %d error %+v, want %d %s", status, apiErr, tt.status, tt.code)
+			}
+		})
+	}
+}
+
+func TestLoginRefreshLogout(t *testing.T) {
+	auth := newTestService(t)
+	call(t, auth.registerHandler, `{"username": "anna", "password": "correct horse", "name": "Анна"}`, nil)
+
+	for _, body := range []string{
+		`{"username": "anna", "password": "wrong password"}`,
+		`{"username": "nobody", "password": "correct horse"}`,
+	} {
+		if status, apiErr := call(t, auth.loginHandler, body, nil); status != http.StatusUnauthorized || apiErr.Code != platform.CodeUnauthorized {
+			t.Errorf("login %s: got status %d error %+v", body, status, apiErr)
+		}
+	}
+
+	var login TokenResponse
+	if status, apiErr := call(t, auth.loginHandler, `{"username": "anna", "password": "correct horse"}`, &login); status != http.StatusOK {
+		t.Fatalf("login: got status %d error %+v", status, apiErr)
+	}
+	verifier := &platform.JWTVerifier{HMACSecret: []byte("secret"), Issuer: "auth-service"}
+	claims, err := verifier.Verify(context.Background(), login.AccessToken)
+	if err != nil {
+		t.Fatalf("access token rejected: %v", err)
+	}
+	if claims.Subject != login.User.ID || claims.Name != "Анна" || login.TokenType != "Bearer" || login.ExpiresIn != 60 {
+		t.Errorf("unexpected login: %+v claims %+v", login, claims)
+	}
+
+	// Refresh tokens are rotated, the old one can no longer be used.
+	var refreshed TokenResponse
+	body := `{"refresh_token": "` + login.RefreshToken + `"}`
+	if status, apiErr := call(t, auth.refreshHandler, body, &refreshed); status != http.StatusOK {
+		t.Fatalf("refresh: got status %d error %+v", status, apiErr)
+	}
+	if refreshed.RefreshToken == login.RefreshToken || refreshed.User.ID != login.User.ID {
+		t.Errorf("unexpected refresh: %+v", refreshed)
+	}
+
+	// Reusing the rotated token revokes every session of the user.
+	if status, _ := call(t, auth.refreshHandler, body, nil); status != http.StatusUnauthorized {
+		t.Errorf("reused refresh token: got status %d", status)
+	}
+	refreshedBody := `{"refresh_token": "` + refreshed.RefreshToken + `"}`
+	if status, _ := call(t, auth.refreshHandler, refreshedBody, nil); status != http.StatusUnauthorized {
+		t.Errorf("refresh after reuse: got status %d", status)
+	}
+
+	// Logout revokes the refresh token.
+	call(t, auth.loginHandler, `{"username": "anna", "password": "correct horse"}`, &login)
+	body = `{"refresh_token": "` + login.RefreshToken + `"}`
+	if status, apiErr := call(t, auth.logoutHandler, body, nil); status != http.StatusOK {
+		t.Fatalf("logout: got status %d error %+v", status, apiErr)
+	}
+	if status, _ := call(t, auth.refreshHandler, body, nil); status != http.StatusUnauthorized {
+		t.Errorf("refresh after logout: got status %d", status)
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	tokens, err := newTokenIssuer(Config{AccessTTL: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(tokens.jwksHandler))
+	defer server.Close()
+
+	token, err := tokens.AccessToken(User{ID: "user-1", Name: "Анна"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier := &platform.JWTVerifier{Keys: platform.NewRemoteJWKS(server.URL, time.Minute)}
+	if _, err := verifier.Verify(context.Background(), token); err != nil {
+		t.Errorf("token not verified with the published key: %v", err)
+	}
+}
+
+func TestSetRole(t *testing.T) {
+	auth := newTestService(t)
+
+	// Admins are granted at startup to existing accounts only, so
+	// registering a listed username does not make it an admin.
+	var admin User
+	call(t, auth.registerHandler, `{"username": "root", "password": "correct horse"}`, &admin)
+	if admin.Role != platform.RoleUser {
+		t.Fatalf("bootstrap admin registered as %q", admin.Role)
+	}
+	if err := auth.store.SetRole(context.Background(), "root", platform.RoleAdmin); err != nil {
+		t.Fatal(err)
+	}
+	var user User
+	call(t, auth.registerHandler, `{"username": "anna", "password": "correct horse"}`, &user)
+	if user.Role != platform.RoleUser {
+		t.Fatalf("user registered as %q", user.Role)
+	}
+
+	r := chi.NewRouter()
+	r.With(platform.TrustGateway("gateway-secret")).Put("/users/{username}/role", auth.setRoleHandler)
+	setRole := func(caller platform.User, username, body string) int {
+		req := httptest.NewRequest("PUT", "/users/"+username+"/role", strings.NewReader(body))
+		if caller.ID != "" {
+			platform.SetUserHeaders(req.Header, caller)
+			req.Header.Set(platform.GatewaySecretHeader, "gateway-secret")
+		}
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	asAdmin := platform.User{ID: admin.ID, Role: platform.RoleAdmin}
+	tests := []struct {
+		name     string
+		caller   platform.User
+		username string
+		body     string
+		status   int
+	}{
+		{"anonymous", platform.User{}, "anna", `{"role": "moderator"}`, http.StatusUnauthorized},
+		{"not an admin", platform.User{ID: user.ID, Role: platform.RoleModerator}, "anna", `{"role": "admin"}`, http.StatusForbidden},
+		{"unknown role", asAdmin, "anna", `{"role": "owner"}`, http.StatusBadRequest},
+		{"unknown user", asAdmin, "nobody", `{"role": "moderator"}`, http.StatusNotFound},
+		{"granted", asAdmin, "anna", `{"role": "moderator"}`, http.StatusOK},
+	}
+	for _, tt := range tests {
+		if status := setRole(tt.caller, tt.username, tt.body); status != tt.status {
+			t.Errorf("%s: got status %d want %d", tt.name, status, tt.status)
+		}
+	}
+
+	// Callers bypassing the gateway cannot claim to be an admin.
+	req := httptest.NewRequest("PUT", "/users/anna/role", strings.NewReader(`{"role": "admin"}`))
+	platform.SetUserHeaders(req.Header, asAdmin)
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("forged admin headers: got status %d want %d", rr.Code, http.StatusUnauthorized)
+	}
+
+	// The role is in tokens issued after the change.
+	var login TokenResponse
+	call(t, auth.loginHandler, `{"username": "anna", "password": "correct horse"}`, &login)
+	verifier := &platform.JWTVerifier{HMACSecret: []byte("secret")}
+	claims, err := verifier.Verify(context.Background(), login.AccessToken)
+	if err != nil || claims.Role != platform.RoleModerator {
+		t.Errorf("unexpected claims %+v: %v", claims, err)
+	}
+}
@@ -0,0 +1,20 @@
+package main
+
+import "testing"
+
+func TestCheckPassword(t *testing.T) {
+	hash := hashPassword("correct horse")
+	if hash == hashPassword("correct horse") {
+		t.Error("hashes of the same password should use different salts")
+	}
+
+	if ok, err := checkPassword("correct horse", hash); err != nil || !ok {
+		t.Errorf("correct password rejected: %v", err)
+	}
+	if ok, err := checkPassword("wrong horse", hash); err != nil || ok {
+		t.Errorf("wrong password accepted: %v", err)
+	}
+	if _, err := checkPassword("correct horse", "$2a$10$bcrypt"); err != errInvalidHash {
+		t.Errorf("expected errInvalidHash, got %v", err)
+	}
+}
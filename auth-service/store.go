@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"platform"
+)
+
+var (
+	errUserExists   = errors.New("user already exists")
+	errUserNotFound = errors.New("user not found")
+	// errTokenReused is returned for a refresh token that was already
+	// rotated or revoked.
+	errTokenReused  = errors.New("refresh token reused")
+	errTokenUnknown = errors.New("unknown or expired refresh token")
+)
+
+var queryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "db_query_duration_seconds",
+	Help:    "SQLite query latency by query.",
+	Buckets: platform.QueryBuckets,
+}, []string{"query"})
+
+// migrations are applied in order at startup. Never edit an applied
+// migration, append a new one instead.
+var migrations = []platform.Migration{
+	{
+		Version: 1,
+		Name:    "create users and refresh tokens",
+		Query: `
+		CREATE TABLE users (
+			id TEXT PRIMARY KEY,
+			username TEXT NOT NULL UNIQUE,
+			name TEXT NOT NULL,
+			password_hash TEXT NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);
+		CREATE TABLE refresh_tokens (
+			token_hash TEXT PRIMARY KEY,
+			user_id TEXT NOT NULL,
+			expires_at DATETIME NOT NULL,
+			revoked_at DATETIME,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (user_id) REFERENCES users (id)
+		);
+		CREATE INDEX idx_refresh_tokens_user_id ON refresh_tokens(user_id);
+		`,
+	},
+	{
+		Version: 2,
+		Name:    "user roles",
+		Query: `
+		ALTER TABLE users ADD COLUMN role TEXT NOT NULL DEFAULT 'user';
+		`,
+	},
+}
+
+type User struct {
+	ID           string    `json:"id"`
+	Username     string    `json:"username"`
+	Name         string    `json:"name"`
+	Role         string    `json:"role"`
+	PasswordHash string    `json:"-"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// Store keeps users and their refresh tokens in SQLite. Only hashes of
+// refresh tokens are stored.
+type Store struct {
+	db *sql.DB
+}
+
+func initDB(dbPath string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		return nil, err
+	}
+	// A single connection keeps ":memory:" databases shared and
+	// serializes token rotation.
+	db.SetMaxOpenConns(1)
+
+	if err := platform.Migrate(db, migrations); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+// startQuery times the named store call and traces it as a child of the
+// span in ctx. The returned function ends both.
+func startQuery(ctx context.Context, name string) func() {
+	start := time.Now()
+	_, span := otel.Tracer(tracerName).Start(ctx, "sqlite "+name, trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("db.system", "sqlite"), attribute.String("db.operation", name)))
+	return func() {
+		queryDuration.WithLabelValues(name).Observe(time.Since(start).Seconds())
+		span.End()
+	}
+}
+
+// hashToken returns the stored form of a refresh token.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateUser saves a new user with role, returning errUserExists if the
+// username is taken.
+func (s *Store) CreateUser(ctx context.Context, username, name, role, passwordHash string) (User, error) {
+	defer startQuery(ctx, "create_user")()
+
+	user := User{
+		ID:           uuid.New().String(),
+		Username:     username,
+		Name:         name,
+		Role:         role,
+		PasswordHash: passwordHash,
+		CreatedAt:    time.Now().UTC().Truncate(time.Second),
+	}
+	result, err := s.db.ExecContext(ctx, `
+		INSERT INTO users (id, username, name, role, password_hash, created_at) VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (username) DO NOTHING`,
+		user.ID, user.Username, user.Name, user.Role, user.PasswordHash, user.CreatedAt)
+	if err != nil {
+		return User{}, err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return User{}, err
+	} else if n == 0 {
+		return User{}, errUserExists
+	}
+	return user, nil
+}
+
+// UserByUsername returns the user with username, or errUserNotFound.
+func (s *Store) UserByUsername(ctx context.Context, username string) (User, error) {
+	defer startQuery(ctx, "user_by_username")()
+	return s.scanUser(s.db.QueryRowContext(ctx,
+		"SELECT id, username, name, role, password_hash, created_at FROM users WHERE username = ?", username))
+}
+
+// UserByID returns the user with id, or errUserNotFound.
+func (s *Store) UserByID(ctx context.Context, id string) (User, error) {
+	defer startQuery(ctx, "user_by_id")()
+	return s.scanUser(s.db.QueryRowContext(ctx,
+		"SELECT id, username, name, role, password_hash, created_at FROM users WHERE id = ?", id))
+}
+
+func (s *Store) scanUser(row *sql.Row) (User, error) {
+	var user User
+	err := row.Scan(&user.ID, &user.Username, &user.Name, &user.Role, &user.PasswordHash, &user.CreatedAt)
+	if err == sql.ErrNoRows {
+		return User{}, errUserNotFound
+	}
+	return user, err
+}
+
+// SetRole changes the role of the user with username, returning
+// errUserNotFound if there is none.
+func (s *Store) SetRole(ctx context.Context, username, role string) error {
+	defer startQuery(ctx, "set_role")()
+	result, err := s.db.ExecContext(ctx, "UPDATE users SET role = ? WHERE username = ?", role, username)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return errUserNotFound
+	}
+	return nil
+}
+
+// SaveRefreshToken stores a refresh token of userID valid until expiresAt.
+func (s *Store) SaveRefreshToken(ctx context.Context, token, userID string, expiresAt time.Time) error {
+	defer startQuery(ctx, "save_refresh_token")()
+	_, err := s.db.ExecContext(ctx,
+		"INSERT INTO refresh_tokens (token_hash, user_id, expires_at) VALUES (?, ?, ?)",
+		hashToken(token), userID, expiresAt.UTC())
+	return err
+}
+
+// UseRefreshToken revokes token and returns its user, so each refresh
+// token can be exchanged once. A token that was already revoked may have
+// been stolen: every session of its user is revoked and errTokenReused is
+// returned.
+func (s *Store) UseRefreshToken(ctx context.Context, token string) (string, error) {
+	defer startQuery(ctx, "use_refresh_token")()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	var userID string
+	var expiresAt time.Time
+	var revokedAt sql.NullTime
+	err = tx.QueryRowContext(ctx,
+		"SELECT user_id, expires_at, revoked_at FROM refresh_tokens WHERE token_hash = ?",
+		hashToken(token)).Scan(&userID, &expiresAt, &revokedAt)
+	if err == sql.ErrNoRows {
+		return "", errTokenUnknown
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if revokedAt.Valid {
+		if _, err := tx.ExecContext(ctx,
+			"UPDATE refresh_tokens SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL",
+			time.Now().UTC(), userID); err != nil {
+			return "", err
+		}
+		if err := tx.Commit(); err != nil {
+			return "", err
+		}
+		return userID, errTokenReused
+	}
+	if !time.Now().Before(expiresAt) {
+		return "", errTokenUnknown
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		"UPDATE refresh_tokens SET revoked_at = ? WHERE token_hash = ?",
+		time.Now().UTC(), hashToken(token)); err != nil {
+		return "", err
+	}
+	return userID, tx.Commit()
+}
+
+// RevokeRefreshToken revokes token, and every other session of its user
+// when all is set. Unknown tokens are ignored so logout is idempotent.
+func (s *Store) RevokeRefreshToken(ctx context.Context, token string, all bool) error {
+	defer startQuery(ctx, "revoke_refresh_token")()
+
+	query := "UPDATE refresh_tokens SET revoked_at = ? WHERE token_hash = ? AND revoked_at IS NULL"
+	if all {
+		query = `
+		UPDATE refresh_tokens SET revoked_at = ?
+		WHERE revoked_at IS NULL
+		  AND user_id = (SELECT user_id FROM refresh_tokens WHERE token_hash = ?)`
+	}
+	_, err := s.db.ExecContext(ctx, query, time.Now().UTC(), hashToken(token))
+	return err
+}
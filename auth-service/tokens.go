@@ -0,0 +1,147 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+
+	"platform"
+)
+
+// TokenIssuer signs access tokens with an RSA key, published as a JWKS, or
+// with a secret shared with the gateway.
+type TokenIssuer struct {
+	secret []byte
+	key    *rsa.PrivateKey
+	keyID  string
+
+	Issuer     string
+	Audience   string
+	AccessTTL  time.Duration
+	RefreshTTL time.Duration
+}
+
+// newTokenIssuer signs with the RSA key in config.SigningKeyFile, else with
+// config.JWTSecret. Without either a key is generated, which invalidates
+// every token when the service restarts.
+func newTokenIssuer(config Config) (*TokenIssuer, error) {
+	issuer := &TokenIssuer{
+		Issuer:     config.Issuer,
+		Audience:   config.Audience,
+		AccessTTL:  config.AccessTTL,
+		RefreshTTL: config.RefreshTTL,
+	}
+
+	switch {
+	case config.SigningKeyFile != "":
+		key, err := loadRSAKey(config.SigningKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		issuer.setKey(key)
+	case config.JWTSecret != "":
+		issuer.secret = []byte(config.JWTSecret)
+	default:
+		slog.Warn("No AUTH_SIGNING_KEY_FILE or JWT_SECRET configured, generating a signing key; tokens are invalidated on restart")
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, err
+		}
+		issuer.setKey(key)
+	}
+	return issuer, nil
+}
+
+// setKey signs with key. The key ID is derived from the public key so it
+// is stable across restarts.
+func (t *TokenIssuer) setKey(key *rsa.PrivateKey) {
+	sum := sha256.Sum256(key.PublicKey.N.Bytes())
+	t.key = key
+	t.keyID = hex.EncodeToString(sum[:8])
+}
+
+// loadRSAKey reads a PEM encoded PKCS #1 or PKCS #8 RSA private key.
+func loadRSAKey(path string) (*rsa.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM data", path)
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: not an RSA key", path)
+	}
+	return key, nil
+}
+
+// AccessToken returns a signed access token for user.
+func (t *TokenIssuer) AccessToken(user User) (string, error) {
+	now := time.Now()
+	claims := platform.Claims{
+		Subject:   user.ID,
+		Name:      user.Name,
+		Role:      user.Role,
+		Issuer:    t.Issuer,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(t.AccessTTL).Unix(),
+		ID:        uuid.New().String(),
+	}
+	if t.Audience != "" {
+		claims.Audience = platform.Audience{t.Audience}
+	}
+
+	if t.key != nil {
+		return platform.SignRS256(claims, t.key, t.keyID)
+	}
+	if t.secret != nil {
+		return platform.SignHS256(claims, t.secret)
+	}
+	return "", errors.New("no signing key")
+}
+
+// newRefreshToken returns an opaque random refresh token.
+func newRefreshToken() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// jwksHandler publishes the public signing key for the gateway. The set is
+// empty when tokens are signed with a shared secret.
+func (t *TokenIssuer) jwksHandler(w http.ResponseWriter, r *http.Request) {
+	keys := map[string]*rsa.PublicKey{}
+	if t.key != nil {
+		keys[t.keyID] = &t.key.PublicKey
+	}
+	body, err := platform.EncodeJWKS(keys)
+	if err != nil {
+		platform.Log(r.Context()).Error("Failed to encode JWKS", "error", err)
+		platform.WriteError(w, r, http.StatusInternalServerError, platform.CodeInternal, "Failed to encode JWKS")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "max-age=300")
+	w.Write(body)
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"platform"
+)
+
+// tombstoneText replaces the text of soft-deleted comments.
+const tombstoneText = "[deleted]"
+
+// Audit actions.
+const (
+	auditDelete  = "delete"
+	auditPurge   = "purge"
+	auditRestore = "restore"
+	auditEdit    = "edit"
+)
+
+// hideDeleted turns a comment deleted at deletedAt into a tombstone. It
+// stays in listings so that its replies keep their place in the thread.
+func (c *Comment) hideDeleted(deletedAt sql.NullString) {
+	if !deletedAt.Valid {
+		return
+	}
+	c.DeletedAt = deletedAt.String
+	c.Text = tombstoneText
+	c.AuthorID = ""
+	c.AuthorName = ""
+}
+
+// audit records that actor performed action on comment, in the
+// transaction of the change itself.
+func audit(ctx context.Context, tx *sql.Tx, action string, actor platform.User, comment Comment) error {
+	defer startQuery(ctx, "insert_audit")()
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO comment_audit (comment_id, news_id, action, actor_id, actor_role, author_id, text)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		comment.ID, comment.NewsID, action, actor.ID, actor.Role, comment.AuthorID, comment.Text)
+	return err
+}
+
+// fetchComment returns the comment with id for the ownership check and
+// the audit record, and when it was soft-deleted.
+func fetchComment(ctx context.Context, tx *sql.Tx, id int) (Comment, sql.NullTime, error) {
+	defer startQuery(ctx, "get_comment")()
+	comment := Comment{ID: id}
+	var deletedAt sql.NullTime
+	err := tx.QueryRowContext(ctx, "SELECT news_id, author_id, text, deleted_at FROM comments WHERE id = ?", id).Scan(
+		&comment.NewsID, &comment.AuthorID, &comment.Text, &deletedAt)
+	return comment, deletedAt, err
+}
+
+// deletedBy returns the ID of the user who last soft-deleted the comment
+// with id, from its audit records.
+func deletedBy(ctx context.Context, tx *sql.Tx, id int) (string, error) {
+	defer startQuery(ctx, "get_deleter")()
+	var actorID string
+	err := tx.QueryRowContext(ctx, `
+		SELECT actor_id FROM comment_audit WHERE comment_id = ? AND action = ?
+		ORDER BY id DESC LIMIT 1`, id, auditDelete).Scan(&actorID)
+	return actorID, err
+}
+
+// threadSQL selects the IDs of a comment and all replies below it.
+const threadSQL = `
+	WITH RECURSIVE thread(id) AS (
+		SELECT ?
+		UNION ALL
+		SELECT c.id FROM comments c JOIN thread t ON c.parent_id = t.id
+	)`
+
+// deleteThread deletes the comment with id and all replies below it, and
+// returns them for the audit records. Replies are deleted in the same
+// statement, so the parent_id foreign key holds.
+func deleteThread(ctx context.Context, tx *sql.Tx, id int) ([]Comment, error) {
+	done := startQuery(ctx, "get_thread")
+	rows, err := tx.QueryContext(ctx, threadSQL+`
+		SELECT c.id, c.news_id, c.author_id, c.text FROM comments c JOIN thread t ON c.id = t.id`, id)
+	done()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var thread []Comment
+	for rows.Next() {
+		var comment Comment
+		if err := rows.Scan(&comment.ID, &comment.NewsID, &comment.AuthorID, &comment.Text); err != nil {
+			return nil, err
+		}
+		thread = append(thread, comment)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	defer startQuery(ctx, "delete_thread")()
+	_, err = tx.ExecContext(ctx, threadSQL+" DELETE FROM comments WHERE id IN (SELECT id FROM thread)", id)
+	return thread, err
+}
+
+// deleteCommentHandler soft-deletes a comment of the calling user, or of
+// anyone when the caller is a moderator or admin, and records who deleted
+// it. Replies stay visible below the tombstone. With cascade=true a
+// moderator deletes the comment and all replies below it for good.
+func deleteCommentHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		actor := platform.UserFromHeaders(r.Header)
+		if actor.ID == "" {
+			platform.WriteError(w, r, http.StatusUnauthorized, platform.CodeUnauthorized, "Authentication required")
+			return
+		}
+
+		idStr := chi.URLParam(r, "id")
+		id, err := strconv.Atoi(idStr)
+		if err != nil {
+			platform.WriteError(w, r, http.StatusBadRequest, platform.CodeInvalidRequest, "Invalid comment ID")
+			return
+		}
+
+		cascade := r.URL.Query().Get("cascade") == "true"
+		if cascade && !actor.CanModerate() {
+			platform.WriteError(w, r, http.StatusForbidden, platform.CodeForbidden, "Only a moderator can delete a comment thread")
+			return
+		}
+
+		tx, err := db.BeginTx(r.Context(), nil)
+		if err != nil {
+			platform.Log(r.Context()).Error("Failed to begin transaction", "error", err)
+			platform.WriteError(w, r, http.StatusInternalServerError, platform.CodeInternal, "Failed to delete comment")
+			return
+		}
+		defer tx.Rollback()
+
+		comment, deletedAt, err := fetchComment(r.Context(), tx, id)
+		if err == nil && deletedAt.Valid && !cascade {
+			err = sql.ErrNoRows
+		}
+		if err != nil {
+			if err == sql.ErrNoRows {
+				platform.WriteError(w, r, http.StatusNotFound, platform.CodeNotFound, "Comment not found")
+				return
+			}
+			platform.Log(r.Context()).Error("Failed to fetch comment", "error", err)
+			platform.WriteError(w, r, http.StatusInternalServerError, platform.CodeInternal, "Failed to fetch comment")
+			return
+		}
+
+		if comment.AuthorID != actor.ID && !actor.CanModerate() {
+			platform.WriteError(w, r, http.StatusForbidden, platform.CodeForbidden, "Only the author or a moderator can delete this comment")
+			return
+		}
+
+		// Delete comment
+		mode, action := "soft", auditDelete
+		deleted := []Comment{comment}
+		if cascade {
+			mode, action = "cascade", auditPurge
+			deleted, err = deleteThread(r.Context(), tx, id)
+		} else {
+			done := startQuery(r.Context(), "soft_delete_comment")
+			_, err = tx.ExecContext(r.Context(), "UPDATE comments SET deleted_at = ? WHERE id = ?",
+				time.Now().UTC().Truncate(time.Second), id)
+			done()
+		}
+		for _, c := range deleted {
+			if err == nil {
+				err = audit(r.Context(), tx, action, actor, c)
+			}
+		}
+		if err == nil {
+			err = tx.Commit()
+		}
+		if err != nil {
+			platform.Log(r.Context()).Error("Failed to delete comment", "error", err)
+			platform.WriteError(w, r, http.StatusInternalServerError, platform.CodeInternal, "Failed to delete comment")
+			return
+		}
+		commentsDeleted.WithLabelValues(mode).Add(float64(len(deleted)))
+		platform.Log(r.Context()).Info("Comment deleted",
+			"comment_id", id, "mode", mode, "count", len(deleted),
+			"actor_id", actor.ID, "actor_role", actor.Role, "author_id", comment.AuthorID)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(platform.Response{
+			Status: "success",
+			Data: map[string]interface{}{
+				"message": "Comment deleted successfully",
+				"deleted": len(deleted),
+			},
+		})
+	}
+}
+
+// restoreCommentHandler restores a soft-deleted comment for a moderator,
+// or for its author when they deleted it themselves, up to window after it
+// was deleted.
+func restoreCommentHandler(db *sql.DB, window time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		actor := platform.UserFromHeaders(r.Header)
+		if actor.ID == "" {
+			platform.WriteError(w, r, http.StatusUnauthorized, platform.CodeUnauthorized, "Authentication required")
+			return
+		}
+
+		id, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			platform.WriteError(w, r, http.StatusBadRequest, platform.CodeInvalidRequest, "Invalid comment ID")
+			return
+		}
+
+		tx, err := db.BeginTx(r.Context(), nil)
+		if err != nil {
+			platform.Log(r.Context()).Error("Failed to begin transaction", "error", err)
+			platform.WriteError(w, r, http.StatusInternalServerError, platform.CodeInternal, "Failed to restore comment")
+			return
+		}
+		defer tx.Rollback()
+
+		comment, deletedAt, err := fetchComment(r.Context(), tx, id)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				platform.WriteError(w, r, http.StatusNotFound, platform.CodeNotFound, "Comment not found")
+				return
+			}
+			platform.Log(r.Context()).Error("Failed to fetch comment", "error", err)
+			platform.WriteError(w, r, http.StatusInternalServerError, platform.CodeInternal, "Failed to fetch comment")
+			return
+		}
+
+		if comment.AuthorID != actor.ID && !actor.CanModerate() {
+			platform.WriteError(w, r, http.StatusForbidden, platform.CodeForbidden, "Only the author or a moderator can restore this comment")
+			return
+		}
+		if !deletedAt.Valid {
+			platform.WriteError(w, r, http.StatusConflict, platform.CodeConflict, "Comment is not deleted")
+			return
+		}
+		if !actor.CanModerate() {
+			// Authors cannot undo the deletion by a moderator.
+			deleter, err := deletedBy(r.Context(), tx, id)
+			if err != nil && err != sql.ErrNoRows {
+				platform.Log(r.Context()).Error("Failed to fetch comment audit", "error", err)
+				platform.WriteError(w, r, http.StatusInternalServerError, platform.CodeInternal, "Failed to restore comment")
+				return
+			}
+			if deleter != actor.ID {
+				platform.WriteError(w, r, http.StatusForbidden, platform.CodeForbidden, "Only a moderator can restore a comment deleted by a moderator")
+				return
+			}
+		}
+		if time.Since(deletedAt.Time) > window {
+			platform.WriteError(w, r, http.StatusConflict, platform.CodeConflict, "Comment can no longer be restored")
+			return
+		}
+
+		done := startQuery(r.Context(), "restore_comment")
+		_, err = tx.ExecContext(r.Context(), "UPDATE comments SET deleted_at = NULL WHERE id = ?", id)
+		done()
+		if err == nil {
+			err = audit(r.Context(), tx, auditRestore, actor, comment)
+		}
+		if err == nil {
+			err = tx.Commit()
+		}
+		if err != nil {
+			platform.Log(r.Context()).Error("Failed to restore comment", "error", err)
+			platform.WriteError(w, r, http.StatusInternalServerError, platform.CodeInternal, "Failed to restore comment")
+			return
+		}
+		commentsRestored.Inc()
+		platform.Log(r.Context()).Info("Comment restored",
+			"comment_id", id, "actor_id", actor.ID, "actor_role", actor.Role, "author_id", comment.AuthorID)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(platform.Response{
+			Status: "success",
+			Data:   map[string]string{"message": "Comment restored successfully"},
+		})
+	}
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"platform"
+)
+
+func TestDeleteCommentAuthorization(t *testing.T) {
+	db, err := initDB(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Close()
+	for _, author := range []string{"author", "author"} {
+		if _, err := db.Exec("INSERT INTO comments (news_id, text, author_id) VALUES (1, 'Hello', ?)", author); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := chi.NewRouter()
+	r.Delete("/comments/{id}", deleteCommentHandler(db))
+	remove := func(id string, user platform.User) int {
+		req := httptest.NewRequest("DELETE", "/comments/"+id, nil)
+		if user.ID != "" {
+			platform.SetUserHeaders(req.Header, user)
+		}
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	tests := []struct {
+		name   string
+		id     string
+		user   platform.User
+		status int
+	}{
+		{"anonymous", "1", platform.User{}, http.StatusUnauthorized},
+		{"other user", "1", platform.User{ID: "other", Role: platform.RoleUser}, http.StatusForbidden},
+		{"author", "1", platform.User{ID: "author", Role: platform.RoleUser}, http.StatusOK},
+		{"already deleted", "1", platform.User{ID: "author", Role: platform.RoleUser}, http.StatusNotFound},
+		{"moderator", "2", platform.User{ID: "mod", Role: platform.RoleModerator}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		if status := remove(tt.id, tt.user); status != tt.status {
+			t.Errorf("%s: got status %v want %v", tt.name, status, tt.status)
+		}
+	}
+
+	rows, err := db.Query("SELECT comment_id, action, actor_id, actor_role, author_id, text FROM comment_audit ORDER BY id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var audit []string
+	for rows.Next() {
+		var commentID int
+		var action, actorID, actorRole, authorID, text string
+		if err := rows.Scan(&commentID, &action, &actorID, &actorRole, &authorID, &text); err != nil {
+			t.Fatal(err)
+		}
+		audit = append(audit, fmt.Sprintf("%d %s %s %s %s %s", commentID, action, actorID, actorRole, authorID, text))
+	}
+	want := []string{"1 delete author user author Hello", "2 delete mod moderator author Hello"}
+	if strings.Join(audit, "\n") != strings.Join(want, "\n") {
+		t.Errorf("unexpected audit records: %q", audit)
+	}
+}
+
+func TestSoftDeleteAndRestore(t *testing.T) {
+	db, err := initDB(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Close()
+	parent := insertComment(t, db, nil)
+	reply := insertComment(t, db, parent)
+	insertComment(t, db, reply)
+
+	r := chi.NewRouter()
+	r.Get("/comments", getCommentsHandler(db))
+	r.Post("/comments", createCommentHandler(db))
+	r.Delete("/comments/{id}", deleteCommentHandler(db))
+	r.Post("/comments/{id}/restore", restoreCommentHandler(db, 24*time.Hour))
+	send := func(method, path, body string, user platform.User) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		platform.SetUserHeaders(req.Header, user)
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+	author := platform.User{ID: "author", Role: platform.RoleUser}
+	other := platform.User{ID: "other", Role: platform.RoleUser}
+	moderator := platform.User{ID: "mod", Role: platform.RoleModerator}
+	listed := func() []Comment {
+		t.Helper()
+		_, response := getCommentList(t, r, "news_id=1")
+		return response.Data
+	}
+
+	if rr := send("DELETE", fmt.Sprintf("/comments/%d", parent), "", author); rr.Code != http.StatusOK {
+		t.Fatalf("soft delete: got status %d: %s", rr.Code, rr.Body)
+	}
+	comments := listed()
+	if len(comments) != 3 {
+		t.Fatalf("replies of a deleted comment should stay visible: %+v", comments)
+	}
+	if c := comments[0]; c.Text != tombstoneText || c.AuthorID != "" || c.DeletedAt == "" || c.ReplyCount != 1 {
+		t.Errorf("deleted comment not replaced by a tombstone: %+v", c)
+	}
+	body := fmt.Sprintf(`{"news_id": 1, "parent_id": %d, "text": "Reply"}`, parent)
+	if rr := send("POST", "/comments", body, author); rr.Code != http.StatusBadRequest {
+		t.Errorf("reply to a deleted comment: got status %d want %d", rr.Code, http.StatusBadRequest)
+	}
+
+	restore := fmt.Sprintf("/comments/%d/restore", parent)
+	for _, tt := range []struct {
+		name   string
+		user   platform.User
+		status int
+	}{
+		{"other user", other, http.StatusForbidden},
+		{"author", author, http.StatusOK},
+		{"not deleted", author, http.StatusConflict},
+	} {
+		if rr := send("POST", restore, "", tt.user); rr.Code != tt.status {
+			t.Errorf("restore by %s: got status %d want %d", tt.name, rr.Code, tt.status)
+		}
+	}
+	if c := listed()[0]; c.Text != "Hello" || c.AuthorID != "author" || c.DeletedAt != "" {
+		t.Errorf("comment not restored: %+v", c)
+	}
+
+	// Deleted comments can only be restored within the window.
+	send("DELETE", fmt.Sprintf("/comments/%d", parent), "", moderator)
+	if _, err := db.Exec("UPDATE comments SET deleted_at = datetime('now', '-2 days')"); err != nil {
+		t.Fatal(err)
+	}
+	if rr := send("POST", restore, "", moderator); rr.Code != http.StatusConflict {
+		t.Errorf("restore after the window: got status %d want %d", rr.Code, http.StatusConflict)
+	}
+}
+
+func TestRestoreAfterModeratorDelete(t *testing.T) {
+	db, err := initDB(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Close()
+	id := insertComment(t, db, nil)
+
+	r := chi.NewRouter()
+	r.Delete("/comments/{id}", deleteCommentHandler(db))
+	r.Post("/comments/{id}/restore", restoreCommentHandler(db, 24*time.Hour))
+	send := func(method, path string, user platform.User) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, path, nil)
+		platform.SetUserHeaders(req.Header, user)
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+	author := platform.User{ID: "author", Role: platform.RoleUser}
+	moderator := platform.User{ID: "mod", Role: platform.RoleModerator}
+	path := fmt.Sprintf("/comments/%d", id)
+
+	if rr := send("DELETE", path, moderator); rr.Code != http.StatusOK {
+		t.Fatalf("delete by a moderator: got status %d: %s", rr.Code, rr.Body)
+	}
+	if rr := send("POST", path+"/restore", author); rr.Code != http.StatusForbidden {
+		t.Errorf("restore by the author: got status %d want %d", rr.Code, http.StatusForbidden)
+	}
+	if rr := send("POST", path+"/restore", moderator); rr.Code != http.StatusOK {
+		t.Errorf("restore by a moderator: got status %d want %d: %s", rr.Code, http.StatusOK, rr.Body)
+	}
+
+	// Only the latest deletion counts.
+	send("DELETE", path, author)
+	if rr := send("POST", path+"/restore", author); rr.Code != http.StatusOK {
+		t.Errorf("restore of their own deletion: got status %d want %d: %s", rr.Code, http.StatusOK, rr.Body)
+	}
+}
+
+func TestForeignKeysOnNewConnections(t *testing.T) {
+	db, err := initDB(filepath.Join(t.TempDir(), "comments.db"))
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Close()
+	// Every statement runs on a fresh connection.
+	db.SetMaxIdleConns(0)
+
+	parent := insertComment(t, db, nil)
+	insertComment(t, db, parent)
+	if _, err := db.Exec("DELETE FROM comments WHERE id = ?", parent); err == nil {
+		t.Error("deleted a comment with replies on a new connection")
+	}
+}
+
+func TestCascadeDelete(t *testing.T) {
+	db, err := initDB(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Close()
+	parent := insertComment(t, db, nil)
+	reply := insertComment(t, db, parent)
+	insertComment(t, db, reply)
+	other := insertComment(t, db, nil)
+
+	// Foreign keys are enforced, so a plain delete cannot orphan replies.
+	if _, err := db.Exec("DELETE FROM comments WHERE id = ?", parent); err == nil {
+		t.Fatal("deleted a comment with replies despite the foreign key")
+	}
+
+	r := chi.NewRouter()
+	r.Delete("/comments/{id}", deleteCommentHandler(db))
+	remove := func(user platform.User) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("DELETE", fmt.Sprintf("/comments/%d?cascade=true", parent), nil)
+		platform.SetUserHeaders(req.Header, user)
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := remove(platform.User{ID: "author", Role: platform.RoleUser}); rr.Code != http.StatusForbidden {
+		t.Errorf("cascade by the author: got status %d want %d", rr.Code, http.StatusForbidden)
+	}
+	rr := remove(platform.User{ID: "mod", Role: platform.RoleModerator})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("cascade by a moderator: got status %d: %s", rr.Code, rr.Body)
+	}
+	var response struct {
+		Data struct {
+			Deleted int `json:"deleted"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil || response.Data.Deleted != 3 {
+		t.Errorf("unexpected response %s: %v", rr.Body, err)
+	}
+
+	var remaining int
+	db.QueryRow("SELECT id FROM comments").Scan(&remaining)
+	var purged int
+	db.QueryRow("SELECT COUNT(*) FROM comment_audit WHERE action = ? AND actor_id = 'mod'", auditPurge).Scan(&purged)
+	if remaining != other || purged != 3 {
+		t.Errorf("unexpected state after cascade: remaining comment %d, %d audit records", remaining, purged)
+	}
+	if err := db.QueryRow("SELECT id FROM comments WHERE id = ?", reply).Scan(new(int)); err != sql.ErrNoRows {
+		t.Errorf("reply not deleted: %v", err)
+	}
+}
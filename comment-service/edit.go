@@ -0,0 +1,182 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"platform"
+)
+
+// EditRequest is the body of PATCH /comments/{id}.
+type EditRequest struct {
+	Text string `json:"text"`
+}
+
+// Revision is a prior text of an edited comment.
+type Revision struct {
+	ID        int    `json:"id"`
+	CommentID int    `json:"comment_id"`
+	Text      string `json:"text"`
+	EditorID  string `json:"editor_id"`
+	CreatedAt string `json:"created_at"`
+}
+
+// editCommentHandler changes the text of a comment of the calling user.
+// The prior text is saved as a revision in the same transaction.
+func editCommentHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		editor := platform.UserFromHeaders(r.Header)
+		if editor.ID == "" {
+			platform.WriteError(w, r, http.StatusUnauthorized, platform.CodeUnauthorized, "Authentication required")
+			return
+		}
+
+		id, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			platform.WriteError(w, r, http.StatusBadRequest, platform.CodeInvalidRequest, "Invalid comment ID")
+			return
+		}
+
+		var req EditRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			platform.WriteError(w, r, http.StatusBadRequest, platform.CodeInvalidRequest, "Invalid request body")
+			return
+		}
+		if req.Text == "" {
+			platform.WriteError(w, r, http.StatusBadRequest, platform.CodeInvalidRequest, "Comment text is required")
+			return
+		}
+
+		tx, err := db.BeginTx(r.Context(), nil)
+		if err != nil {
+			platform.Log(r.Context()).Error("Failed to begin transaction", "error", err)
+			platform.WriteError(w, r, http.StatusInternalServerError, platform.CodeInternal, "Failed to edit comment")
+			return
+		}
+		defer tx.Rollback()
+
+		comment, deletedAt, err := fetchComment(r.Context(), tx, id)
+		if err == nil && deletedAt.Valid {
+			err = sql.ErrNoRows
+		}
+		if err != nil {
+			if err == sql.ErrNoRows {
+				platform.WriteError(w, r, http.StatusNotFound, platform.CodeNotFound, "Comment not found")
+				return
+			}
+			platform.Log(r.Context()).Error("Failed to fetch comment", "error", err)
+			platform.WriteError(w, r, http.StatusInternalServerError, platform.CodeInternal, "Failed to fetch comment")
+			return
+		}
+
+		if comment.AuthorID != editor.ID {
+			platform.WriteError(w, r, http.StatusForbidden, platform.CodeForbidden, "Only the author can edit this comment")
+			return
+		}
+
+		// An unchanged text is not a new revision.
+		if req.Text != comment.Text {
+			done := startQuery(r.Context(), "insert_revision")
+			_, err = tx.ExecContext(r.Context(),
+				"INSERT INTO comment_revisions (comment_id, text, editor_id) VALUES (?, ?, ?)",
+				id, comment.Text, editor.ID)
+			done()
+			if err == nil {
+				done = startQuery(r.Context(), "edit_comment")
+				_, err = tx.ExecContext(r.Context(), "UPDATE comments SET text = ?, edited_at = ? WHERE id = ?",
+					req.Text, time.Now().UTC().Truncate(time.Second), id)
+				done()
+			}
+			if err == nil {
+				err = audit(r.Context(), tx, auditEdit, editor, comment)
+			}
+		}
+		if err == nil {
+			err = tx.Commit()
+		}
+		if err != nil {
+			platform.Log(r.Context()).Error("Failed to edit comment", "error", err)
+			platform.WriteError(w, r, http.StatusInternalServerError, platform.CodeInternal, "Failed to edit comment")
+			return
+		}
+
+		comment, err = getComment(r.Context(), db, id)
+		if err != nil {
+			platform.Log(r.Context()).Error("Failed to fetch edited comment", "error", err)
+			platform.WriteError(w, r, http.StatusInternalServerError, platform.CodeInternal, "Failed to fetch edited comment")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(platform.Response{
+			Status: "success",
+			Data:   comment,
+		})
+	}
+}
+
+// getRevisionsHandler returns the prior texts of a comment, oldest first.
+// Only moderators and admins can see the edit history.
+func getRevisionsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := platform.UserFromHeaders(r.Header)
+		if user.ID == "" {
+			platform.WriteError(w, r, http.StatusUnauthorized, platform.CodeUnauthorized, "Authentication required")
+			return
+		}
+		if !user.CanModerate() {
+			platform.WriteError(w, r, http.StatusForbidden, platform.CodeForbidden, "Only a moderator can view the edit history")
+			return
+		}
+
+		id, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			platform.WriteError(w, r, http.StatusBadRequest, platform.CodeInvalidRequest, "Invalid comment ID")
+			return
+		}
+
+		if _, err := getComment(r.Context(), db, id); err != nil {
+			if err == sql.ErrNoRows {
+				platform.WriteError(w, r, http.StatusNotFound, platform.CodeNotFound, "Comment not found")
+				return
+			}
+			platform.Log(r.Context()).Error("Failed to fetch comment", "error", err)
+			platform.WriteError(w, r, http.StatusInternalServerError, platform.CodeInternal, "Failed to fetch comment")
+			return
+		}
+
+		done := startQuery(r.Context(), "list_revisions")
+		rows, err := db.QueryContext(r.Context(),
+			"SELECT id, comment_id, text, editor_id, created_at FROM comment_revisions WHERE comment_id = ? ORDER BY id", id)
+		done()
+		if err != nil {
+			platform.Log(r.Context()).Error("Failed to fetch revisions", "error", err)
+			platform.WriteError(w, r, http.StatusInternalServerError, platform.CodeInternal, "Failed to fetch revisions")
+			return
+		}
+		defer rows.Close()
+
+		revisions := []Revision{}
+		for rows.Next() {
+			var revision Revision
+			err := rows.Scan(&revision.ID, &revision.CommentID, &revision.Text, &revision.EditorID, &revision.CreatedAt)
+			if err != nil {
+				platform.Log(r.Context()).Error("Failed to scan revision", "error", err)
+				platform.WriteError(w, r, http.StatusInternalServerError, platform.CodeInternal, "Failed to scan revision")
+				return
+			}
+			revisions = append(revisions, revision)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(platform.Response{
+			Status: "success",
+			Data:   revisions,
+		})
+	}
+}
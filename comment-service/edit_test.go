@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+
+	"platform"
+)
+
+func TestEditComment(t *testing.T) {
+	db, err := initDB(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Close()
+	id := insertComment(t, db, nil)
+
+	r := chi.NewRouter()
+	r.Patch("/comments/{id}", editCommentHandler(db))
+	r.Get("/comments/{id}/revisions", getRevisionsHandler(db))
+	r.Delete("/comments/{id}", deleteCommentHandler(db))
+	send := func(method, path, body string, user platform.User) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		platform.SetUserHeaders(req.Header, user)
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+	author := platform.User{ID: "author", Role: platform.RoleUser}
+	moderator := platform.User{ID: "mod", Role: platform.RoleModerator}
+	path := fmt.Sprintf("/comments/%d", id)
+
+	for _, tt := range []struct {
+		name   string
+		body   string
+		user   platform.User
+		status int
+	}{
+		{"anonymous", `{"text": "Updated"}`, platform.User{}, http.StatusUnauthorized},
+		{"moderator", `{"text": "Updated"}`, moderator, http.StatusForbidden},
+		{"empty text", `{"text": ""}`, author, http.StatusBadRequest},
+		{"author", `{"text": "Updated"}`, author, http.StatusOK},
+		{"unchanged", `{"text": "Updated"}`, author, http.StatusOK},
+		{"author again", `{"text": "Final"}`, author, http.StatusOK},
+	} {
+		if rr := send("PATCH", path, tt.body, tt.user); rr.Code != tt.status {
+			t.Errorf("%s: got status %d want %d: %s", tt.name, rr.Code, tt.status, rr.Body)
+		}
+	}
+
+	comment, err := getComment(context.Background(), db, id)
+	if err != nil || comment.Text != "Final" || comment.EditedAt == "" {
+		t.Errorf("comment not edited: %+v: %v", comment, err)
+	}
+
+	if rr := send("GET", path+"/revisions", "", author); rr.Code != http.StatusForbidden {
+		t.Errorf("revisions for the author: got status %d want %d", rr.Code, http.StatusForbidden)
+	}
+	rr := send("GET", path+"/revisions", "", moderator)
+	var response struct {
+		Data []Revision `json:"data"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("could not unmarshal response: %v", err)
+	}
+	if len(response.Data) != 2 || response.Data[0].Text != "Hello" || response.Data[1].Text != "Updated" || response.Data[0].EditorID != "author" {
+		t.Errorf("unexpected revisions: %+v", response.Data)
+	}
+
+	// Deleted comments cannot be edited, and their revisions go with them.
+	send("DELETE", path, "", author)
+	if rr := send("PATCH", path, `{"text": "After"}`, author); rr.Code != http.StatusNotFound {
+		t.Errorf("edit after delete: got status %d want %d", rr.Code, http.StatusNotFound)
+	}
+	send("DELETE", path+"?cascade=true", "", moderator)
+	var revisions int
+	db.QueryRow("SELECT COUNT(*) FROM comment_revisions").Scan(&revisions)
+	if revisions != 0 {
+		t.Errorf("%d revisions left after the comment was purged", revisions)
+	}
+}
@@ -4,46 +4,69 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
-	"fmt"
-	"log"
 	"net/http"
-	"os"
-	"os/signal"
 	"strconv"
 	"strings"
 	"time"
 
-	"github.com/go-chi/chi/v5"
-	"github.com/go-chi/chi/v5/middleware"
-	"github.com/google/uuid"
 	_ "github.com/mattn/go-sqlite3"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"platform"
 )
 
-type Config struct {
-	Port string
-	DBPath string
-}
+// tracerName names the tracer of the spans started by the service.
+const tracerName = "comment-service"
 
-type Response struct {
-	Status     string      `json:"status"`
-	Data       interface{} `json:"data,omitempty"`
-	Error      string      `json:"error,omitempty"`
-	Pagination *Pagination `json:"pagination,omitempty"`
-}
+var (
+	commentsCreated = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "comments_created_total",
+		Help: "Comments saved.",
+	})
+	commentsDeleted = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "comments_deleted_total",
+		Help: "Comments deleted by mode: soft or cascade.",
+	}, []string{"mode"})
+	commentsRestored = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "comments_restored_total",
+		Help: "Soft-deleted comments restored.",
+	})
+	queryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "db_query_duration_seconds",
+		Help:    "SQLite query latency by query.",
+		Buckets: platform.QueryBuckets,
+	}, []string{"query"})
+)
 
-type Pagination struct {
-	Page      int `json:"page"`
-	PageSize  int `json:"page_size"`
-	Total     int `json:"total"`
-	TotalPages int `json:"total_pages"`
+type Config struct {
+	Port   string
+	DBPath string
+	// RestoreWindow is how long a soft-deleted comment can be restored.
+	RestoreWindow time.Duration
+	// GatewaySecret authenticates the user headers set by the gateway.
+	GatewaySecret string
 }
 
 type Comment struct {
-	ID        int            `json:"id"`
-	NewsID    int            `json:"news_id"`
-	ParentID  *int           `json:"parent_id,omitempty"`
-	Text      string         `json:"text"`
-	CreatedAt string         `json:"created_at"`
+	ID         int    `json:"id"`
+	NewsID     int    `json:"news_id"`
+	ParentID   *int   `json:"parent_id,omitempty"`
+	Text       string `json:"text"`
+	AuthorID   string `json:"author_id,omitempty"`
+	AuthorName string `json:"author_name,omitempty"`
+	CreatedAt  string `json:"created_at"`
+	// EditedAt is set once the text has been changed, the prior texts
+	// are kept in comment_revisions.
+	EditedAt string `json:"edited_at,omitempty"`
+	// DeletedAt is set for soft-deleted comments, whose text and author
+	// are hidden.
+	DeletedAt string `json:"deleted_at,omitempty"`
+	// ReplyCount counts the direct replies to the comment.
+	ReplyCount int `json:"reply_count"`
 }
 
 type CommentRequest struct {
@@ -53,192 +76,329 @@ type CommentRequest struct {
 }
 
 func main() {
+	platform.SetupLogging("comment-service")
+
 	config := Config{
-		Port:   getEnv("COMMENT_SERVICE_PORT", "8081"),
-		DBPath: getEnv("COMMENT_DB_PATH", "./comments.db"),
+		Port:          platform.GetEnv("COMMENT_SERVICE_PORT", "8081"),
+		DBPath:        platform.GetEnv("COMMENT_DB_PATH", "./comments.db"),
+		RestoreWindow: platform.GetDurationEnv("COMMENT_RESTORE_WINDOW", 7*24*time.Hour),
+		GatewaySecret: platform.GetEnv("GATEWAY_SECRET", ""),
 	}
 
+	flushTraces := platform.SetupTracing("comment-service")
+	defer flushTraces()
+
 	db, err := initDB(config.DBPath)
 	if err != nil {
-		log.Fatalf("Failed to initialize database: %v", err)
+		platform.Fatal("Failed to initialize database", "error", err)
 	}
+	// Closed after Run returns, once in-flight requests have drained.
 	defer db.Close()
 
-	r := chi.NewRouter()
-
-	// Middleware
-	r.Use(middleware.RequestID)
-	r.Use(middleware.RealIP)
-	r.Use(middleware.Logger)
-	r.Use(middleware.Recoverer)
-	r.Use(requestIDMiddleware)
-	r.Use(loggerMiddleware)
+	server := platform.NewServer("Comment Service", config.Port)
+	server.AddHealthCheck(platform.HealthCheck{Name: "sqlite", Check: db.PingContext})
+	r := server.Router.With(platform.TrustGateway(config.GatewaySecret))
 
 	// Routes
-	r.Get("/health", healthHandler)
 	r.Get("/comments", getCommentsHandler(db))
+	r.Get("/comments/tree", getCommentTreeHandler(db))
 	r.Post("/comments", createCommentHandler(db))
+	r.Patch("/comments/{id}", editCommentHandler(db))
+	r.Get("/comments/{id}/revisions", getRevisionsHandler(db))
 	r.Delete("/comments/{id}", deleteCommentHandler(db))
+	r.Post("/comments/{id}/restore", restoreCommentHandler(db, config.RestoreWindow))
 
-	// Graceful shutdown
-	server := &http.Server{
-		Addr:    ":" + config.Port,
-		Handler: r,
-	}
-
-	done := make(chan os.Signal, 1)
-	signal.Notify(done, os.Interrupt)
-	go func() {
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("Server failed to start: %v", err)
-		}
-	}()
-
-	log.Printf("Comment Service starting on port %s", config.Port)
-	<-done
-	log.Println("Server stopped gracefully")
-}
-
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+	if err := server.Run(); err != nil {
+		platform.Fatal("Server failed to start", "error", err)
 	}
-	return defaultValue
-}
-
-func requestIDMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		requestID := r.Header.Get("X-Request-ID")
-		if requestID == "" {
-			requestID = uuid.New().String()
-		}
-		ctx := context.WithValue(r.Context(), "request_id", requestID)
-		next.ServeHTTP(w, r.WithContext(ctx))
-	})
 }
 
-func loggerMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		start := time.Now()
-		next.ServeHTTP(w, r)
-		log.Printf("[%s] %s %s %s", 
-			r.Context().Value("request_id"), 
-			r.Method, 
-			r.URL.Path, 
-			time.Since(start))
-	})
+// migrations are applied in order at startup. Never edit an applied
+// migration, append a new one instead.
+var migrations = []platform.Migration{
+	{
+		Version: 1,
+		Name:    "create comments table",
+		Query: `
+		CREATE TABLE IF NOT EXISTS comments (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			news_id INTEGER NOT NULL,
+			parent_id INTEGER,
+			text TEXT NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (parent_id) REFERENCES comments (id)
+		);
+		CREATE INDEX IF NOT EXISTS idx_news_id ON comments(news_id);
+		CREATE INDEX IF NOT EXISTS idx_parent_id ON comments(parent_id);
+		`,
+	},
+	{
+		Version: 2,
+		Name:    "comment authors",
+		Query: `
+		ALTER TABLE comments ADD COLUMN author_id TEXT NOT NULL DEFAULT '';
+		ALTER TABLE comments ADD COLUMN author_name TEXT NOT NULL DEFAULT '';
+		CREATE INDEX idx_author_id ON comments(author_id);
+		`,
+	},
+	{
+		Version: 3,
+		Name:    "comment audit log",
+		Query: `
+		CREATE TABLE comment_audit (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			comment_id INTEGER NOT NULL,
+			news_id INTEGER NOT NULL,
+			action TEXT NOT NULL,
+			actor_id TEXT NOT NULL,
+			actor_role TEXT NOT NULL,
+			author_id TEXT NOT NULL,
+			text TEXT NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);
+		CREATE INDEX idx_comment_audit_comment_id ON comment_audit(comment_id);
+		CREATE INDEX idx_comment_audit_actor_id ON comment_audit(actor_id);
+		`,
+	},
+	{
+		Version: 4,
+		Name:    "soft deletion",
+		// Replies orphaned by hard deletes before foreign keys were
+		// enforced become top-level comments.
+		Query: `
+		ALTER TABLE comments ADD COLUMN deleted_at DATETIME;
+		UPDATE comments SET parent_id = NULL
+		WHERE parent_id IS NOT NULL AND parent_id NOT IN (SELECT id FROM comments);
+		`,
+	},
+	{
+		Version: 5,
+		Name:    "comment revisions",
+		Query: `
+		ALTER TABLE comments ADD COLUMN edited_at DATETIME;
+		CREATE TABLE comment_revisions (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			comment_id INTEGER NOT NULL REFERENCES comments (id) ON DELETE CASCADE,
+			text TEXT NOT NULL,
+			editor_id TEXT NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);
+		CREATE INDEX idx_comment_revisions_comment_id ON comment_revisions(comment_id);
+		`,
+	},
 }
 
 func initDB(dbPath string) (*sql.DB, error) {
-	db, err := sql.Open("sqlite3", dbPath)
+	// foreign_keys is a per-connection pragma, so the driver sets it on
+	// every connection it opens.
+	dsn := dbPath + "?_foreign_keys=on"
+	if strings.Contains(dbPath, "?") {
+		dsn = dbPath + "&_foreign_keys=on"
+	}
+	db, err := sql.Open("sqlite3", dsn)
 	if err != nil {
 		return nil, err
 	}
+	// A single connection keeps ":memory:" databases shared.
+	db.SetMaxOpenConns(1)
 
-	// Create comments table
-	query := `
-	CREATE TABLE IF NOT EXISTS comments (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		news_id INTEGER NOT NULL,
-		parent_id INTEGER,
-		text TEXT NOT NULL,
-		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-		FOREIGN KEY (parent_id) REFERENCES comments (id)
-	);
-	CREATE INDEX IF NOT EXISTS idx_news_id ON comments(news_id);
-	CREATE INDEX IF NOT EXISTS idx_parent_id ON comments(parent_id);
-	`
-	
-	_, err = db.Exec(query)
-	if err != nil {
+	if err := platform.Migrate(db, migrations); err != nil {
+		db.Close()
 		return nil, err
 	}
 
 	return db, nil
 }
 
-func healthHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(Response{Status: "ok"})
+// startQuery times the named query and traces it as a child of the
+// request span. The returned function ends both.
+func startQuery(ctx context.Context, name string) func() {
+	start := time.Now()
+	_, span := otel.Tracer(tracerName).Start(ctx, "sqlite "+name, trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("db.system", "sqlite"), attribute.String("db.operation", name)))
+	return func() {
+		queryDuration.WithLabelValues(name).Observe(time.Since(start).Seconds())
+		span.End()
+	}
 }
 
+// getCommentsHandler lists the comments of a news item a page at a time,
+// by page number or after the next_cursor of the previous page.
 func getCommentsHandler(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		newsIDStr := r.URL.Query().Get("news_id")
 		if newsIDStr == "" {
-			http.Error(w, "news_id parameter is required", http.StatusBadRequest)
+			platform.WriteError(w, r, http.StatusBadRequest, platform.CodeInvalidRequest, "news_id parameter is required")
 			return
 		}
 
 		newsID, err := strconv.Atoi(newsIDStr)
 		if err != nil {
-			http.Error(w, "Invalid news_id parameter", http.StatusBadRequest)
+			platform.WriteError(w, r, http.StatusBadRequest, platform.CodeInvalidRequest, "Invalid news_id parameter")
+			return
+		}
+
+		page, pageSize, after, err := parsePageParams(r.URL.Query())
+		if err != nil {
+			platform.WriteError(w, r, http.StatusBadRequest, platform.CodeInvalidRequest, err.Error())
+			return
+		}
+		sortBy := r.URL.Query().Get("sort")
+		if sortBy == "" {
+			sortBy = sortOldest
+		}
+		if !validSort(sortBy) {
+			platform.WriteError(w, r, http.StatusBadRequest, platform.CodeInvalidRequest, "sort must be oldest, newest or most_replied")
+			return
+		}
+
+		cursor := &commentCursor{Sort: sortBy}
+		if after != "" {
+			cursor, err = decodeCommentCursor(after)
+			if err != nil || cursor.Sort != sortBy {
+				platform.WriteError(w, r, http.StatusBadRequest, platform.CodeInvalidRequest, "Invalid after cursor")
+				return
+			}
+		}
+
+		var total int
+		done := startQuery(r.Context(), "count_comments")
+		err = db.QueryRowContext(r.Context(), "SELECT COUNT(*) FROM comments WHERE news_id = ?", newsID).Scan(&total)
+		done()
+		if err != nil {
+			platform.Log(r.Context()).Error("Failed to count comments", "error", err)
+			platform.WriteError(w, r, http.StatusInternalServerError, platform.CodeInternal, "Failed to fetch comments")
 			return
 		}
 
-		// Query comments for the news item
-		query := "SELECT id, news_id, parent_id, text, created_at FROM comments WHERE news_id = ? ORDER BY created_at ASC"
-		rows, err := db.Query(query, newsID)
+		// Query comments for the news item, one more than the page size to
+		// tell whether there is a next page
+		order, afterCondition, afterArgs := cursor.orderBy()
+		query := `
+			SELECT id, news_id, parent_id, text, author_id, author_name, created_at, edited_at, deleted_at, reply_count FROM (
+				SELECT c.id, c.news_id, c.parent_id, c.text, c.author_id, c.author_name, c.created_at, c.edited_at, c.deleted_at,
+					(SELECT COUNT(*) FROM comments r WHERE r.parent_id = c.id) AS reply_count
+				FROM comments c WHERE c.news_id = ?
+			)`
+		args := []interface{}{newsID}
+		if after != "" {
+			query += " WHERE " + afterCondition
+			args = append(args, afterArgs...)
+		}
+		offset := 0
+		if after == "" {
+			offset = (page - 1) * pageSize
+		}
+		query += " ORDER BY " + order + " LIMIT ? OFFSET ?"
+		args = append(args, pageSize+1, offset)
+
+		done = startQuery(r.Context(), "list_comments")
+		rows, err := db.QueryContext(r.Context(), query, args...)
+		done()
 		if err != nil {
-			http.Error(w, "Failed to fetch comments", http.StatusInternalServerError)
+			platform.Log(r.Context()).Error("Failed to fetch comments", "error", err)
+			platform.WriteError(w, r, http.StatusInternalServerError, platform.CodeInternal, "Failed to fetch comments")
 			return
 		}
 		defer rows.Close()
 
-		var comments []Comment
+		comments := []Comment{}
 		for rows.Next() {
 			var comment Comment
 			var parentID sql.NullInt64
-			err := rows.Scan(&comment.ID, &comment.NewsID, &parentID, &comment.Text, &comment.CreatedAt)
+			var editedAt, deletedAt sql.NullString
+			err := rows.Scan(&comment.ID, &comment.NewsID, &parentID, &comment.Text, &comment.AuthorID, &comment.AuthorName, &comment.CreatedAt, &editedAt, &deletedAt, &comment.ReplyCount)
 			if err != nil {
-				http.Error(w, "Failed to scan comment", http.StatusInternalServerError)
+				platform.Log(r.Context()).Error("Failed to scan comment", "error", err)
+				platform.WriteError(w, r, http.StatusInternalServerError, platform.CodeInternal, "Failed to scan comment")
 				return
 			}
-			
+			comment.EditedAt = editedAt.String
+			comment.hideDeleted(deletedAt)
+
 			if parentID.Valid {
 				pid := int(parentID.Int64)
 				comment.ParentID = &pid
 			}
-			
+
 			comments = append(comments, comment)
 		}
+		if err := rows.Err(); err != nil {
+			platform.Log(r.Context()).Error("Failed to fetch comments", "error", err)
+			platform.WriteError(w, r, http.StatusInternalServerError, platform.CodeInternal, "Failed to fetch comments")
+			return
+		}
+
+		pagination := &platform.Pagination{
+			PageSize:   pageSize,
+			Total:      total,
+			TotalPages: (total + pageSize - 1) / pageSize,
+		}
+		if after == "" {
+			pagination.Page = page
+		}
+		if len(comments) > pageSize {
+			comments = comments[:pageSize]
+			last := comments[pageSize-1]
+			pagination.NextCursor = commentCursor{Sort: sortBy, Replies: last.ReplyCount, ID: last.ID}.encode()
+		}
 
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(Response{
-			Status: "success",
-			Data:   comments,
+		json.NewEncoder(w).Encode(platform.Response{
+			Status:     "success",
+			Data:       comments,
+			Pagination: pagination,
 		})
 	}
 }
 
 func createCommentHandler(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		// The gateway only forwards requests with a verified user.
+		author := platform.UserFromHeaders(r.Header)
+		if author.ID == "" {
+			platform.WriteError(w, r, http.StatusUnauthorized, platform.CodeUnauthorized, "Authentication required")
+			return
+		}
+
 		var req CommentRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			platform.WriteError(w, r, http.StatusBadRequest, platform.CodeInvalidRequest, "Invalid request body")
 			return
 		}
 
 		// Validate input
 		if req.Text == "" {
-			http.Error(w, "Comment text is required", http.StatusBadRequest)
+			platform.WriteError(w, r, http.StatusBadRequest, platform.CodeInvalidRequest, "Comment text is required")
 			return
 		}
 		if req.NewsID <= 0 {
-			http.Error(w, "Valid news ID is required", http.StatusBadRequest)
+			platform.WriteError(w, r, http.StatusBadRequest, platform.CodeInvalidRequest, "Valid news ID is required")
 			return
 		}
-		
-		// Check if parent_id exists if provided
+
+		// Check that parent_id, if provided, is a comment on the same news item
 		if req.ParentID != nil {
-			var exists int
-			err := db.QueryRow("SELECT 1 FROM comments WHERE id = ?", *req.ParentID).Scan(&exists)
+			var parentNewsID int
+			var deletedAt sql.NullString
+			done := startQuery(r.Context(), "parent_exists")
+			err := db.QueryRowContext(r.Context(), "SELECT news_id, deleted_at FROM comments WHERE id = ?", *req.ParentID).Scan(&parentNewsID, &deletedAt)
+			done()
 			if err != nil {
 				if err == sql.ErrNoRows {
-					http.Error(w, "Parent comment does not exist", http.StatusBadRequest)
+					platform.WriteError(w, r, http.StatusBadRequest, platform.CodeInvalidRequest, "Parent comment does not exist")
 					return
 				}
-				http.Error(w, "Failed to validate parent comment", http.StatusInternalServerError)
+				platform.Log(r.Context()).Error("Failed to validate parent comment", "error", err)
+				platform.WriteError(w, r, http.StatusInternalServerError, platform.CodeInternal, "Failed to validate parent comment")
+				return
+			}
+			if parentNewsID != req.NewsID {
+				platform.WriteError(w, r, http.StatusBadRequest, platform.CodeInvalidRequest, "Parent comment belongs to another news item")
+				return
+			}
+			if deletedAt.Valid {
+				platform.WriteError(w, r, http.StatusBadRequest, platform.CodeInvalidRequest, "Parent comment has been deleted")
 				return
 			}
 		}
@@ -248,75 +408,64 @@ func createCommentHandler(db *sql.DB) http.HandlerFunc {
 		if req.ParentID != nil && *req.ParentID > 0 {
 			parentID = req.ParentID
 		}
-		
-		query := "INSERT INTO comments (news_id, parent_id, text) VALUES (?, ?, ?)"
-		result, err := db.Exec(query, req.NewsID, parentID, req.Text)
+
+		query := "INSERT INTO comments (news_id, parent_id, text, author_id, author_name) VALUES (?, ?, ?, ?, ?)"
+		done := startQuery(r.Context(), "insert_comment")
+		result, err := db.ExecContext(r.Context(), query, req.NewsID, parentID, req.Text, author.ID, author.Name)
+		done()
 		if err != nil {
-			http.Error(w, "Failed to save comment", http.StatusInternalServerError)
+			platform.Log(r.Context()).Error("Failed to save comment", "error", err)
+			platform.WriteError(w, r, http.StatusInternalServerError, platform.CodeInternal, "Failed to save comment")
 			return
 		}
+		commentsCreated.Inc()
 
 		id, err := result.LastInsertId()
 		if err != nil {
-			http.Error(w, "Failed to get inserted comment ID", http.StatusInternalServerError)
+			platform.Log(r.Context()).Error("Failed to get inserted comment ID", "error", err)
+			platform.WriteError(w, r, http.StatusInternalServerError, platform.CodeInternal, "Failed to get inserted comment ID")
 			return
 		}
 
 		// Get the inserted comment
-		var comment Comment
-		var parentId sql.NullInt64
-		err = db.QueryRow("SELECT id, news_id, parent_id, text, created_at FROM comments WHERE id = ?", id).Scan(
-			&comment.ID, &comment.NewsID, &parentId, &comment.Text, &comment.CreatedAt)
+		comment, err := getComment(r.Context(), db, int(id))
 		if err != nil {
-			http.Error(w, "Failed to fetch inserted comment", http.StatusInternalServerError)
+			platform.Log(r.Context()).Error("Failed to fetch inserted comment", "error", err)
+			platform.WriteError(w, r, http.StatusInternalServerError, platform.CodeInternal, "Failed to fetch inserted comment")
 			return
 		}
-		
-		if parentId.Valid {
-			pid := int(parentId.Int64)
-			comment.ParentID = &pid
-		}
 
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(Response{
+		json.NewEncoder(w).Encode(platform.Response{
 			Status: "success",
 			Data:   comment,
 		})
 	}
 }
 
-func deleteCommentHandler(db *sql.DB) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		idStr := chi.URLParam(r, "id")
-		id, err := strconv.Atoi(idStr)
-		if err != nil {
-			http.Error(w, "Invalid comment ID", http.StatusBadRequest)
-			return
-		}
-
-		// Check if comment exists
-		var exists int
-		err = db.QueryRow("SELECT 1 FROM comments WHERE id = ?", id).Scan(&exists)
-		if err != nil {
-			if err == sql.ErrNoRows {
-				http.Error(w, "Comment not found", http.StatusNotFound)
-				return
-			}
-			http.Error(w, "Failed to check comment existence", http.StatusInternalServerError)
-			return
-		}
-
-		// Delete comment
-		_, err = db.Exec("DELETE FROM comments WHERE id = ?", id)
-		if err != nil {
-			http.Error(w, "Failed to delete comment", http.StatusInternalServerError)
-			return
-		}
+// getComment returns the comment with id as shown to clients, or
+// sql.ErrNoRows.
+func getComment(ctx context.Context, db *sql.DB, id int) (Comment, error) {
+	defer startQuery(ctx, "get_comment")()
+
+	var comment Comment
+	var parentID sql.NullInt64
+	var editedAt, deletedAt sql.NullString
+	err := db.QueryRowContext(ctx, `
+		SELECT id, news_id, parent_id, text, author_id, author_name, created_at, edited_at, deleted_at,
+			(SELECT COUNT(*) FROM comments r WHERE r.parent_id = c.id)
+		FROM comments c WHERE id = ?`, id).Scan(
+		&comment.ID, &comment.NewsID, &parentID, &comment.Text, &comment.AuthorID, &comment.AuthorName,
+		&comment.CreatedAt, &editedAt, &deletedAt, &comment.ReplyCount)
+	if err != nil {
+		return Comment{}, err
+	}
 
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(Response{
-			Status: "success",
-			Data:   map[string]string{"message": "Comment deleted successfully"},
-		})
+	if parentID.Valid {
+		pid := int(parentID.Int64)
+		comment.ParentID = &pid
 	}
-}
\ No newline at end of file
+	comment.EditedAt = editedAt.String
+	comment.hideDeleted(deletedAt)
+	return comment, nil
+}
@@ -1,71 +1,128 @@
 package main
 
 import (
-	"database/sql"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+
+	"platform"
 )
 
-func TestHealthHandler(t *testing.T) {
-	req, err := http.NewRequest("GET", "/health", nil)
+func TestInitDB(t *testing.T) {
+	db, err := initDB(":memory:")
 	if err != nil {
-		t.Fatal(err)
+		t.Fatalf("Failed to initialize database: %v", err)
 	}
+	defer db.Close()
 
-	rr := httptest.NewRecorder()
-	handler := http.HandlerFunc(healthHandler)
+	// Test that tables were created
+	_, err = db.Exec("SELECT 1 FROM comments LIMIT 1")
+	if err != nil {
+		t.Errorf("comments table was not created properly: %v", err)
+	}
+}
 
-	handler.ServeHTTP(rr, req)
+func TestGetCommentsHandlerErrors(t *testing.T) {
+	db, err := initDB(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Close()
+
+	req := httptest.NewRequest("GET", "/comments", nil)
+	rr := httptest.NewRecorder()
+	platform.RequestID(getCommentsHandler(db)).ServeHTTP(rr, req)
 
-	if status := rr.Code; status != http.StatusOK {
-		t.Errorf("handler returned wrong status code: got %v want %v",
-			status, http.StatusOK)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+	if contentType := rr.Header().Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("unexpected content type: %q", contentType)
 	}
 
-	var response Response
+	var response platform.Response
 	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
-		t.Errorf("could not unmarshal response: %v", err)
+		t.Fatalf("could not unmarshal response: %v", err)
 	}
-
-	if response.Status != "ok" {
-		t.Errorf("handler returned unexpected body: got %v want %v",
-			response.Status, "ok")
+	if response.Status != "error" || response.Error == nil {
+		t.Fatalf("unexpected response: %+v", response)
+	}
+	if response.Error.Code != platform.CodeInvalidRequest || response.Error.RequestID == "" {
+		t.Errorf("unexpected error: %+v", response.Error)
 	}
 }
 
-func TestInitDB(t *testing.T) {
+func TestCreateCommentAuthor(t *testing.T) {
 	db, err := initDB(":memory:")
 	if err != nil {
 		t.Fatalf("Failed to initialize database: %v", err)
 	}
 	defer db.Close()
+	handler := platform.RequestID(createCommentHandler(db))
 
-	// Test that tables were created
-	_, err = db.Exec("SELECT 1 FROM comments LIMIT 1")
-	if err != nil {
-		t.Errorf("comments table was not created properly: %v", err)
+	req := httptest.NewRequest("POST", "/comments", strings.NewReader(`{"news_id":1,"text":"Hello"}`))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("anonymous comment: got status %v want %v", rr.Code, http.StatusUnauthorized)
+	}
+
+	req = httptest.NewRequest("POST", "/comments", strings.NewReader(`{"news_id":1,"text":"Hello"}`))
+	platform.SetUserHeaders(req.Header, platform.User{ID: "user-1", Name: "Анна", Role: platform.RoleUser})
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v: %s", rr.Code, http.StatusOK, rr.Body)
+	}
+
+	var response struct {
+		Data Comment `json:"data"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("could not unmarshal response: %v", err)
+	}
+	if response.Data.AuthorID != "user-1" || response.Data.AuthorName != "Анна" {
+		t.Errorf("unexpected author: %+v", response.Data)
 	}
 }
 
-func TestRequestIDMiddleware(t *testing.T) {
-	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		requestID := r.Context().Value("request_id")
-		if requestID == nil {
-			t.Error("request_id not found in context")
-		}
-		w.WriteHeader(http.StatusOK)
-	})
+func TestCreateCommentParentOnSameNews(t *testing.T) {
+	db, err := initDB(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Close()
+	parent := insertComment(t, db, nil)
+	handler := createCommentHandler(db)
 
-	middleware := requestIDMiddleware(nextHandler)
-	req, _ := http.NewRequest("GET", "/", nil)
-	rr := httptest.NewRecorder()
-	
-	middleware.ServeHTTP(rr, req)
-	
-	if rr.Code != http.StatusOK {
-		t.Errorf("handler returned wrong status code: got %v want %v",
-			rr.Code, http.StatusOK)
+	tests := []struct {
+		name    string
+		body    string
+		status  int
+		message string
+	}{
+		{"same news", fmt.Sprintf(`{"news_id": 1, "parent_id": %d, "text": "Reply"}`, parent), http.StatusOK, ""},
+		{"other news", fmt.Sprintf(`{"news_id": 2, "parent_id": %d, "text": "Reply"}`, parent), http.StatusBadRequest, "Parent comment belongs to another news item"},
+		{"missing parent", `{"news_id": 1, "parent_id": 100, "text": "Reply"}`, http.StatusBadRequest, "Parent comment does not exist"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("POST", "/comments", strings.NewReader(tt.body))
+		platform.SetUserHeaders(req.Header, platform.User{ID: "user-1", Role: platform.RoleUser})
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != tt.status {
+			t.Errorf("%s: got status %d want %d: %s", tt.name, rr.Code, tt.status, rr.Body)
+			continue
+		}
+		var response platform.Response
+		if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+			t.Fatalf("could not unmarshal response: %v", err)
+		}
+		if tt.message != "" && (response.Error == nil || response.Error.Message != tt.message) {
+			t.Errorf("%s: unexpected error %+v", tt.name, response.Error)
+		}
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+	// maxPage keeps the offset of page-based listings small; deeper
+	// pages are reached with cursors.
+	maxPage = 10000
+)
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// Comment listing orders.
+const (
+	sortOldest      = "oldest"
+	sortNewest      = "newest"
+	sortMostReplied = "most_replied"
+)
+
+// commentCursor marks the last comment of a page so the next page can
+// continue after it even when comments are added in between. It is sent to
+// clients as an opaque string.
+type commentCursor struct {
+	Sort    string `json:"s"`
+	Replies int    `json:"r,omitempty"`
+	ID      int    `json:"i"`
+}
+
+func (c commentCursor) encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCommentCursor(value string) (*commentCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+	var c commentCursor
+	if err := json.Unmarshal(data, &c); err != nil || c.ID <= 0 || !validSort(c.Sort) {
+		return nil, errInvalidCursor
+	}
+	return &c, nil
+}
+
+func validSort(sort string) bool {
+	return sort == sortOldest || sort == sortNewest || sort == sortMostReplied
+}
+
+// orderBy returns the ORDER BY clause of sort and the condition selecting
+// the comments after the cursor. IDs break ties, and follow the creation
+// order unlike created_at which has one second resolution.
+func (c commentCursor) orderBy() (order, after string, args []interface{}) {
+	switch c.Sort {
+	case sortNewest:
+		return "id DESC", "id < ?", []interface{}{c.ID}
+	case sortMostReplied:
+		return "reply_count DESC, id ASC", "(reply_count < ? OR (reply_count = ? AND id > ?))",
+			[]interface{}{c.Replies, c.Replies, c.ID}
+	}
+	return "id ASC", "id > ?", []interface{}{c.ID}
+}
+
+// parsePageParams reads and validates page, page_size and after.
+// Missing values fall back to defaults, page_size is capped at
+// maxPageSize and page may not exceed maxPage.
+func parsePageParams(query url.Values) (page, pageSize int, after string, err error) {
+	page, pageSize = 1, defaultPageSize
+
+	if value := query.Get("page"); value != "" {
+		page, err = strconv.Atoi(value)
+		if err != nil || page < 1 {
+			return 0, 0, "", errors.New("page must be a positive integer")
+		}
+		if page > maxPage {
+			return 0, 0, "", fmt.Errorf("page must not exceed %d, use after to go further", maxPage)
+		}
+	}
+
+	if value := query.Get("page_size"); value != "" {
+		pageSize, err = strconv.Atoi(value)
+		if err != nil || pageSize < 1 {
+			return 0, 0, "", errors.New("page_size must be a positive integer")
+		}
+		if pageSize > maxPageSize {
+			pageSize = maxPageSize
+		}
+	}
+
+	after = query.Get("after")
+	if after != "" && query.Get("page") != "" {
+		return 0, 0, "", errors.New("page and after cannot be combined")
+	}
+
+	return page, pageSize, after, nil
+}
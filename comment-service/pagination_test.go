@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"platform"
+)
+
+type commentListResponse struct {
+	Data       []Comment            `json:"data"`
+	Pagination *platform.Pagination `json:"pagination"`
+}
+
+func getCommentList(t *testing.T, handler http.Handler, query string) (int, commentListResponse) {
+	t.Helper()
+
+	req := httptest.NewRequest("GET", "/comments?"+query, nil)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	var response commentListResponse
+	if rr.Code == http.StatusOK {
+		if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+			t.Fatalf("could not unmarshal response: %v", err)
+		}
+	}
+	return rr.Code, response
+}
+
+func commentIDs(comments []Comment) []int {
+	ids := []int{}
+	for _, comment := range comments {
+		ids = append(ids, comment.ID)
+	}
+	return ids
+}
+
+func TestGetCommentsPagination(t *testing.T) {
+	db, err := initDB(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Close()
+
+	// Comments 1 to 5, 2 has two replies and 4 one.
+	for i := 0; i < 5; i++ {
+		insertComment(t, db, nil)
+	}
+	for _, parent := range []int{2, 2, 4} {
+		insertComment(t, db, parent)
+	}
+	handler := getCommentsHandler(db)
+
+	tests := []struct {
+		query string
+		ids   []int
+	}{
+		{"news_id=1&page_size=3", []int{1, 2, 3}},
+		{"news_id=1&page_size=3&page=3", []int{7, 8}},
+		{"news_id=1&page_size=3&page=4", []int{}},
+		{"news_id=1&page_size=3&page=10000", []int{}},
+		{"news_id=1&page_size=3&sort=newest", []int{8, 7, 6}},
+		{"news_id=1&page_size=3&sort=most_replied", []int{2, 4, 1}},
+	}
+	for _, tt := range tests {
+		status, response := getCommentList(t, handler, tt.query)
+		if status != http.StatusOK {
+			t.Fatalf("%s: got status %d", tt.query, status)
+		}
+		if got := commentIDs(response.Data); fmt.Sprint(got) != fmt.Sprint(tt.ids) {
+			t.Errorf("%s: got %v want %v", tt.query, got, tt.ids)
+		}
+		if response.Pagination.Total != 8 || response.Pagination.TotalPages != 3 {
+			t.Errorf("%s: unexpected pagination %+v", tt.query, response.Pagination)
+		}
+	}
+
+	// Following the cursors visits every comment once, in order.
+	want := map[string]string{
+		sortOldest:      "[1 2 3 4 5 6 7 8]",
+		sortNewest:      "[8 7 6 5 4 3 2 1]",
+		sortMostReplied: "[2 4 1 3 5 6 7 8]",
+	}
+	for _, sort := range []string{sortOldest, sortNewest, sortMostReplied} {
+		var ids []int
+		_, response := getCommentList(t, handler, "news_id=1&page_size=3&sort="+sort)
+		for {
+			ids = append(ids, commentIDs(response.Data)...)
+			if response.Pagination.NextCursor == "" {
+				break
+			}
+			_, response = getCommentList(t, handler, "news_id=1&page_size=3&sort="+sort+"&after="+response.Pagination.NextCursor)
+		}
+		if fmt.Sprint(ids) != want[sort] {
+			t.Errorf("%s: cursors visited %v want %s", sort, ids, want[sort])
+		}
+	}
+
+	cursor := commentCursor{Sort: sortNewest, ID: 3}.encode()
+	for _, query := range []string{
+		"news_id=1&page=0",
+		"news_id=1&page=10001",
+		"news_id=1&page=1000000000000000000",
+		"news_id=1&page_size=x",
+		"news_id=1&sort=best",
+		"news_id=1&page=2&after=" + cursor,
+		"news_id=1&sort=oldest&after=" + cursor,
+		"news_id=1&after=!",
+	} {
+		if status, _ := getCommentList(t, handler, query); status != http.StatusBadRequest {
+			t.Errorf("%s: got status %d want %d", query, status, http.StatusBadRequest)
+		}
+	}
+}
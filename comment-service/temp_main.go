@@ -1 +0,0 @@
-package main; import "fmt"; func main() { fmt.Println("Hello World") }
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"platform"
+)
+
+const (
+	defaultTreeDepth   = 3
+	maxTreeDepth       = 10
+	defaultTreeReplies = 3
+	defaultTreePage    = 20
+)
+
+// CommentNode is a comment with the first of its replies. NextCursor is
+// set when some of them were not included, either because of the reply
+// limit or the depth limit.
+type CommentNode struct {
+	Comment
+	Replies    []*CommentNode `json:"replies"`
+	NextCursor string         `json:"next_cursor,omitempty"`
+}
+
+// treeCursor continues a level of the tree after the comment ID, or from
+// its first reply when ID is 0. Parent is 0 for top-level comments. It is
+// sent to clients as an opaque string.
+type treeCursor struct {
+	Parent int `json:"p,omitempty"`
+	ID     int `json:"i,omitempty"`
+}
+
+func (c treeCursor) encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeTreeCursor(value string) (treeCursor, error) {
+	var c treeCursor
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return c, errInvalidCursor
+	}
+	if err := json.Unmarshal(data, &c); err != nil || c.Parent < 0 || c.ID < 0 {
+		return c, errInvalidCursor
+	}
+	return c, nil
+}
+
+// treeQuery selects a page of one level of the comment tree of a news item
+// and the replies below it.
+type treeQuery struct {
+	NewsID   int
+	After    treeCursor
+	PageSize int
+	// Depth is the number of levels returned, Replies the number of
+	// replies returned per comment below the first level.
+	Depth   int
+	Replies int
+}
+
+// parseTreeQuery reads news_id, after, page_size, depth and replies.
+// Missing values fall back to defaults, larger ones are capped.
+func parseTreeQuery(query url.Values) (treeQuery, error) {
+	q := treeQuery{PageSize: defaultTreePage, Depth: defaultTreeDepth, Replies: defaultTreeReplies}
+
+	newsID, err := strconv.Atoi(query.Get("news_id"))
+	if err != nil || newsID <= 0 {
+		return q, errors.New("news_id must be a positive integer")
+	}
+	q.NewsID = newsID
+
+	if value := query.Get("after"); value != "" {
+		if q.After, err = decodeTreeCursor(value); err != nil {
+			return q, errors.New("Invalid after cursor")
+		}
+	}
+
+	for _, param := range []struct {
+		key   string
+		value *int
+		max   int
+	}{
+		{"page_size", &q.PageSize, maxPageSize},
+		{"depth", &q.Depth, maxTreeDepth},
+		{"replies", &q.Replies, maxPageSize},
+	} {
+		value := query.Get(param.key)
+		if value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			return q, fmt.Errorf("%s must be a positive integer", param.key)
+		}
+		if n > param.max {
+			n = param.max
+		}
+		*param.value = n
+	}
+
+	return q, nil
+}
+
+// treeSQL walks the tree down from the requested level with a recursive
+// CTE over idx_parent_id. One extra comment of the first level is fetched
+// to tell whether there are more, replies beyond the limit are cut by
+// their position among their siblings.
+const treeSQL = `
+	WITH RECURSIVE tree(id, depth) AS (
+		SELECT id, 1 FROM (
+			SELECT id FROM comments
+			WHERE news_id = ? AND parent_id IS ? AND id > ?
+			ORDER BY id LIMIT ?
+		)
+		UNION ALL
+		SELECT c.id, t.depth + 1 FROM comments c JOIN tree t ON c.parent_id = t.id
+		WHERE t.depth < ?
+	)
+	SELECT id, news_id, parent_id, text, author_id, author_name, created_at, edited_at, deleted_at, depth, reply_count FROM (
+		SELECT c.id, c.news_id, c.parent_id, c.text, c.author_id, c.author_name, c.created_at, c.edited_at, c.deleted_at, t.depth,
+			(SELECT COUNT(*) FROM comments r WHERE r.parent_id = c.id) AS reply_count,
+			ROW_NUMBER() OVER (PARTITION BY c.parent_id ORDER BY c.id) AS position
+		FROM tree t JOIN comments c ON c.id = t.id
+	)
+	WHERE depth = 1 OR position <= ?
+	ORDER BY depth, id`
+
+// commentTree returns the comments of the requested level with their
+// replies, and the pagination of that level.
+func commentTree(ctx context.Context, db *sql.DB, q treeQuery) ([]*CommentNode, *platform.Pagination, error) {
+	var parentID interface{}
+	if q.After.Parent > 0 {
+		parentID = q.After.Parent
+	}
+
+	var total int
+	done := startQuery(ctx, "count_tree_level")
+	err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM comments WHERE news_id = ? AND parent_id IS ?",
+		q.NewsID, parentID).Scan(&total)
+	done()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	done = startQuery(ctx, "comment_tree")
+	rows, err := db.QueryContext(ctx, treeSQL, q.NewsID, parentID, q.After.ID, q.PageSize+1, q.Depth, q.Replies)
+	done()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	roots := []*CommentNode{}
+	nodes := map[int]*CommentNode{}
+	more := false
+	for rows.Next() {
+		var node CommentNode
+		var parent sql.NullInt64
+		var editedAt, deletedAt sql.NullString
+		var depth int
+		err := rows.Scan(&node.ID, &node.NewsID, &parent, &node.Text, &node.AuthorID, &node.AuthorName,
+			&node.CreatedAt, &editedAt, &deletedAt, &depth, &node.ReplyCount)
+		if err != nil {
+			return nil, nil, err
+		}
+		node.EditedAt = editedAt.String
+		node.hideDeleted(deletedAt)
+		node.Replies = []*CommentNode{}
+
+		if depth == 1 {
+			if len(roots) == q.PageSize {
+				// The extra comment only tells that there are more.
+				more = true
+				continue
+			}
+			roots = append(roots, &node)
+		} else {
+			// Replies of cut comments have no parent node and are dropped.
+			p, ok := nodes[int(parent.Int64)]
+			if !ok {
+				continue
+			}
+			p.Replies = append(p.Replies, &node)
+		}
+		if parent.Valid {
+			pid := int(parent.Int64)
+			node.ParentID = &pid
+		}
+		nodes[node.ID] = &node
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	for _, node := range nodes {
+		if shown := len(node.Replies); shown < node.ReplyCount {
+			cursor := treeCursor{Parent: node.ID}
+			if shown > 0 {
+				cursor.ID = node.Replies[shown-1].ID
+			}
+			node.NextCursor = cursor.encode()
+		}
+	}
+
+	pagination := &platform.Pagination{
+		PageSize:   q.PageSize,
+		Total:      total,
+		TotalPages: (total + q.PageSize - 1) / q.PageSize,
+	}
+	if more {
+		last := roots[len(roots)-1]
+		pagination.NextCursor = treeCursor{Parent: q.After.Parent, ID: last.ID}.encode()
+	}
+
+	return roots, pagination, nil
+}
+
+// getCommentTreeHandler returns the comments of a news item as a tree of
+// replies. Passing the next_cursor of a comment as after loads more of its
+// replies, the one of the pagination more top-level comments.
+func getCommentTreeHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query, err := parseTreeQuery(r.URL.Query())
+		if err != nil {
+			platform.WriteError(w, r, http.StatusBadRequest, platform.CodeInvalidRequest, err.Error())
+			return
+		}
+
+		roots, pagination, err := commentTree(r.Context(), db, query)
+		if err != nil {
+			platform.Log(r.Context()).Error("Failed to fetch comment tree", "error", err)
+			platform.WriteError(w, r, http.StatusInternalServerError, platform.CodeInternal, "Failed to fetch comment tree")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(platform.Response{
+			Status:     "success",
+			Data:       roots,
+			Pagination: pagination,
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"platform"
+)
+
+// insertComment adds a comment to news item 1 and returns its ID.
+func insertComment(t *testing.T, db *sql.DB, parentID interface{}) int {
+	t.Helper()
+	result, err := db.Exec("INSERT INTO comments (news_id, parent_id, text, author_id) VALUES (1, ?, 'Hello', 'author')", parentID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, _ := result.LastInsertId()
+	return int(id)
+}
+
+func TestCommentTree(t *testing.T) {
+	db, err := initDB(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Close()
+
+	// 1
+	// ├── 3
+	// │   └── 6
+	// │       └── 7
+	// ├── 4
+	// └── 5
+	// 2
+	root1 := insertComment(t, db, nil)
+	root2 := insertComment(t, db, nil)
+	reply1 := insertComment(t, db, root1)
+	reply2 := insertComment(t, db, root1)
+	reply3 := insertComment(t, db, root1)
+	nested := insertComment(t, db, reply1)
+	deepest := insertComment(t, db, nested)
+
+	fetch := func(query string) ([]*CommentNode, *platform.Pagination) {
+		t.Helper()
+		req := httptest.NewRequest("GET", "/comments/tree?"+query, nil)
+		rr := httptest.NewRecorder()
+		getCommentTreeHandler(db).ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%s: got status %d: %s", query, rr.Code, rr.Body)
+		}
+		var response struct {
+			Data       []*CommentNode       `json:"data"`
+			Pagination *platform.Pagination `json:"pagination"`
+		}
+		if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+			t.Fatal(err)
+		}
+		return response.Data, response.Pagination
+	}
+
+	roots, pagination := fetch("news_id=1&page_size=1&depth=3&replies=2")
+	if len(roots) != 1 || roots[0].ID != root1 || pagination.Total != 2 || pagination.NextCursor == "" {
+		t.Fatalf("unexpected first page: %+v %+v", roots, pagination)
+	}
+	root := roots[0]
+	if root.ReplyCount != 3 || len(root.Replies) != 2 || root.Replies[0].ID != reply1 || root.Replies[1].ID != reply2 {
+		t.Fatalf("unexpected replies: %+v", root)
+	}
+	if leaf := root.Replies[0].Replies; len(leaf) != 1 || leaf[0].ID != nested || len(leaf[0].Replies) != 0 {
+		t.Fatalf("unexpected nested replies: %+v", leaf)
+	}
+	// The depth limit leaves the reply of the nested comment to load later.
+	if cursor := root.Replies[0].Replies[0].NextCursor; cursor == "" {
+		t.Error("no cursor at the depth limit")
+	} else if replies, _ := fetch("news_id=1&after=" + cursor); len(replies) != 1 || replies[0].ID != deepest {
+		t.Errorf("unexpected replies after depth limit: %+v", replies)
+	}
+
+	replies, pagination := fetch("news_id=1&after=" + root.NextCursor)
+	if len(replies) != 1 || replies[0].ID != reply3 || pagination.Total != 3 || pagination.NextCursor != "" {
+		t.Errorf("unexpected more replies: %+v %+v", replies, pagination)
+	}
+
+	_, pagination = fetch("news_id=1&page_size=1&depth=1")
+	roots, pagination = fetch("news_id=1&page_size=1&after=" + pagination.NextCursor)
+	if len(roots) != 1 || roots[0].ID != root2 || pagination.NextCursor != "" {
+		t.Errorf("unexpected second page: %+v %+v", roots, pagination)
+	}
+
+	for _, query := range []string{"", "news_id=x", "news_id=1&depth=0", "news_id=1&after=!"} {
+		req := httptest.NewRequest("GET", "/comments/tree?"+query, nil)
+		rr := httptest.NewRecorder()
+		getCommentTreeHandler(db).ServeHTTP(rr, req)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%q: got status %d want %d", query, rr.Code, http.StatusBadRequest)
+		}
+	}
+}
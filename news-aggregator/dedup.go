@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// titleDuplicateWindow bounds how far apart two stories with similar
+// titles may be published to be treated as the same story.
+const titleDuplicateWindow = 48 * time.Hour
+
+// titleSimilarityThreshold is the minimal Jaccard similarity of title
+// words for two stories to be considered duplicates.
+const titleSimilarityThreshold = 0.7
+
+// minTitleTokens keeps short, generic titles such as "Главное за день"
+// from being merged.
+const minTitleTokens = 4
+
+// newsCandidate is a feed item prepared for deduplication.
+type newsCandidate struct {
+	FeedItem
+	GUIDHash      string
+	CanonicalLink string
+}
+
+func newCandidate(item FeedItem) newsCandidate {
+	return newsCandidate{
+		FeedItem:      item,
+		GUIDHash:      hashGUID(item.GUID),
+		CanonicalLink: canonicalizeLink(item.Link),
+	}
+}
+
+// saveItems stores feed items, merging duplicates into existing stories
+// as alternate sources. It returns the number of new stories.
+func saveItems(ctx context.Context, store NewsStore, items []FeedItem) (int, error) {
+	inserted := 0
+	for _, item := range items {
+		if !validFeedItem(item) {
+			continue
+		}
+		candidate := newCandidate(item)
+
+		known, err := store.HasGUID(ctx, candidate.GUIDHash)
+		if err != nil {
+			return inserted, err
+		}
+		if known {
+			continue
+		}
+
+		newsID, err := store.FindDuplicate(ctx, candidate)
+		if err == nil {
+			if err := store.AddSource(ctx, newsID, candidate); err != nil {
+				return inserted, err
+			}
+			continue
+		}
+		if err != ErrNewsNotFound {
+			return inserted, err
+		}
+
+		if _, err := store.InsertNews(ctx, candidate); err != nil {
+			if err == errNewsExists {
+				continue
+			}
+			return inserted, err
+		}
+		inserted++
+	}
+	return inserted, nil
+}
+
+// hashGUID returns a fixed-length key for a feed item GUID.
+func hashGUID(guid string) string {
+	sum := sha256.Sum256([]byte(strings.TrimSpace(guid)))
+	return hex.EncodeToString(sum[:])
+}
+
+// trackingParams are query parameters that never change the article.
+var trackingParams = map[string]bool{
+	"fbclid":    true,
+	"gclid":     true,
+	"yclid":     true,
+	"mc_cid":    true,
+	"mc_eid":    true,
+	"_openstat": true,
+}
+
+// canonicalizeLink normalizes an article URL so the same article reached
+// through different tracking links compares equal. Unparsable links are
+// returned trimmed but otherwise unchanged.
+func canonicalizeLink(link string) string {
+	link = strings.TrimSpace(link)
+	u, err := url.Parse(link)
+	if err != nil || u.Host == "" {
+		return link
+	}
+
+	scheme := strings.ToLower(u.Scheme)
+	if scheme == "http" {
+		scheme = "https"
+	}
+	u.Scheme = scheme
+
+	host := strings.ToLower(u.Hostname())
+	host = strings.TrimPrefix(host, "www.")
+	if port := u.Port(); port != "" && port != "80" && port != "443" {
+		host += ":" + port
+	}
+	u.Host = host
+	u.User = nil
+	u.Fragment = ""
+
+	query := u.Query()
+	for key := range query {
+		lower := strings.ToLower(key)
+		if strings.HasPrefix(lower, "utm_") || trackingParams[lower] {
+			query.Del(key)
+		}
+	}
+	// Encode sorts keys, so parameter order does not matter.
+	u.RawQuery = query.Encode()
+
+	if len(u.Path) > 1 {
+		u.Path = strings.TrimRight(u.Path, "/")
+	}
+	if u.Path == "/" {
+		u.Path = ""
+	}
+	u.RawPath = ""
+
+	return u.String()
+}
+
+// titleTokens splits a title into lowercase words, ignoring punctuation
+// and single letters.
+func titleTokens(title string) []string {
+	words := strings.FieldsFunc(strings.ToLower(title), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	seen := make(map[string]bool, len(words))
+	tokens := make([]string, 0, len(words))
+	for _, word := range words {
+		if len([]rune(word)) < 2 || seen[word] {
+			continue
+		}
+		seen[word] = true
+		tokens = append(tokens, word)
+	}
+	sort.Strings(tokens)
+	return tokens
+}
+
+// similarTitles reports whether two titles most likely describe the
+// same story.
+func similarTitles(a, b string) bool {
+	ta, tb := titleTokens(a), titleTokens(b)
+	if len(ta) < minTitleTokens || len(tb) < minTitleTokens {
+		return false
+	}
+
+	set := make(map[string]bool, len(ta))
+	for _, token := range ta {
+		set[token] = true
+	}
+	common := 0
+	for _, token := range tb {
+		if set[token] {
+			common++
+		}
+	}
+	union := len(ta) + len(tb) - common
+	return float64(common)/float64(union) >= titleSimilarityThreshold
+}
+
+// withinDuplicateWindow reports whether two publication times are close
+// enough for their stories to be merged.
+func withinDuplicateWindow(a, b time.Time) bool {
+	diff := a.Sub(b)
+	if diff < 0 {
+		diff = -diff
+	}
+	return diff <= titleDuplicateWindow
+}
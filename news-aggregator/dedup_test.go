@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"platform"
+)
+
+func TestCanonicalizeLink(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"https://example.com/news/1", "https://example.com/news/1"},
+		{"http://WWW.Example.com/news/1/", "https://example.com/news/1"},
+		{"https://example.com:443/news/1?utm_source=rss&utm_medium=feed", "https://example.com/news/1"},
+		{"https://example.com/news?b=2&a=1&fbclid=xyz#comments", "https://example.com/news?a=1&b=2"},
+		{"https://example.com/", "https://example.com"},
+		{"https://example.com:8080/news", "https://example.com:8080/news"},
+		{"not a url", "not a url"},
+	}
+
+	for _, tt := range tests {
+		if got := canonicalizeLink(tt.in); got != tt.want {
+			t.Errorf("canonicalizeLink(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSimilarTitles(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"Центробанк сохранил ключевую ставку на уровне 16%", "Центробанк сохранил ключевую ставку на уровне 16%!", true},
+		{"ЦБ сохранил ключевую ставку на уровне 16%", "Центробанк сохранил ключевую ставку на уровне 16%", true},
+		{"Центробанк сохранил ключевую ставку", "Центробанк повысил ключевую ставку до 18%", false},
+		{"Главное за день", "Главное за день", false},
+	}
+
+	for _, tt := range tests {
+		if got := similarTitles(tt.a, tt.b); got != tt.want {
+			t.Errorf("similarTitles(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestSaveItemsMergesDuplicates(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Second)
+
+	for name, store := range storeImplementations(t) {
+		t.Run(name, func(t *testing.T) {
+			first := []FeedItem{
+				{Feed: "https://a.example/rss", GUID: "a-1", Title: "Центробанк сохранил ключевую ставку на уровне 16%", Link: "https://news.example/cb?utm_source=a", PublishedAt: now},
+			}
+			if _, err := saveItems(ctx, store, first); err != nil {
+				t.Fatalf("saveItems returned error: %v", err)
+			}
+
+			second := []FeedItem{
+				// Same feed, same article with different tracking params.
+				{Feed: "https://a.example/rss", GUID: "a-1-repost", Title: "Центробанк сохранил ставку", Link: "http://www.news.example/cb?utm_source=b", PublishedAt: now},
+				// Another feed linking to the same article.
+				{Feed: "https://b.example/rss", GUID: "b-1", Title: "Ставка не изменилась", Link: "https://news.example/cb", PublishedAt: now},
+				// Another feed with its own article about the same story.
+				{Feed: "https://c.example/rss", GUID: "c-1", Title: "ЦБ сохранил ключевую ставку на уровне 16%", Link: "https://c.example/story", PublishedAt: now.Add(time.Hour)},
+				// Unrelated story.
+				{Feed: "https://c.example/rss", GUID: "c-2", Title: "Открылась новая выставка современного искусства", Link: "https://c.example/art", PublishedAt: now},
+			}
+			inserted, err := saveItems(ctx, store, second)
+			if err != nil {
+				t.Fatalf("saveItems returned error: %v", err)
+			}
+			if inserted != 1 {
+				t.Errorf("expected 1 new story, got %d", inserted)
+			}
+
+			news, _, err := store.ListNews(ctx, NewsListing{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(news) != 2 {
+				t.Fatalf("expected 2 stories, got %d", len(news))
+			}
+
+			var story *NewsItem
+			for i := range news {
+				if news[i].Link == "https://news.example/cb?utm_source=a" {
+					story = &news[i]
+				}
+			}
+			if story == nil {
+				t.Fatalf("original story not found in %+v", news)
+			}
+
+			want := []AlternateSource{
+				{Feed: "https://b.example/rss", Link: "https://news.example/cb"},
+				{Feed: "https://c.example/rss", Link: "https://c.example/story"},
+			}
+			if len(story.AlternateSources) != len(want) {
+				t.Fatalf("expected alternate sources %+v, got %+v", want, story.AlternateSources)
+			}
+			for i := range want {
+				if story.AlternateSources[i] != want[i] {
+					t.Errorf("alternate source %d: got %+v want %+v", i, story.AlternateSources[i], want[i])
+				}
+			}
+
+			// Re-polling must not record the sources again.
+			if _, err := saveItems(ctx, store, second); err != nil {
+				t.Fatal(err)
+			}
+			item, err := store.GetNews(ctx, story.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(item.AlternateSources) != len(want) {
+				t.Errorf("expected %d alternate sources after re-poll, got %d", len(want), len(item.AlternateSources))
+			}
+		})
+	}
+}
+
+func TestDedupMigrationBackfillsExistingNews(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "news.db")
+
+	// Create a database with the schema as it was before deduplication.
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := platform.Migrate(db, migrations[:2]); err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec("INSERT INTO news (guid, title, content, link, published_at) VALUES (?, ?, ?, ?, ?)",
+		"old-1", "Старая новость", "", "https://example.com/old?utm_source=rss", time.Now().UTC().Format(dateFormat))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	store, err := NewSQLiteStore(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+	defer store.Close()
+
+	known, err := store.HasGUID(context.Background(), hashGUID("old-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !known {
+		t.Error("expected GUID hash to be backfilled")
+	}
+
+	id, err := store.FindDuplicate(context.Background(), newCandidate(FeedItem{GUID: "new", Title: "Другое", Link: "https://example.com/old"}))
+	if err != nil {
+		t.Fatalf("expected canonical link to be backfilled, got %v", err)
+	}
+	if id != 1 {
+		t.Errorf("unexpected duplicate ID: %d", id)
+	}
+}
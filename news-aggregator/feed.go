@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// FeedItem is a single entry parsed from an RSS 2.0 or Atom feed.
+type FeedItem struct {
+	Feed        string
+	Category    string
+	Source      string
+	GUID        string
+	Title       string
+	Content     string
+	Link        string
+	PublishedAt time.Time
+}
+
+type rssFeed struct {
+	Channel struct {
+		Items []rssItem `xml:"item"`
+	} `xml:"channel"`
+}
+
+type rssItem struct {
+	GUID        string   `xml:"guid"`
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link"`
+	Description string   `xml:"description"`
+	Encoded     string   `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+	PubDate     string   `xml:"pubDate"`
+	Categories  []string `xml:"category"`
+}
+
+type atomFeed struct {
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomEntry struct {
+	ID         string         `xml:"id"`
+	Title      string         `xml:"title"`
+	Links      []atomLink     `xml:"link"`
+	Summary    string         `xml:"summary"`
+	Content    string         `xml:"content"`
+	Published  string         `xml:"published"`
+	Updated    string         `xml:"updated"`
+	Categories []atomCategory `xml:"category"`
+}
+
+type atomCategory struct {
+	Term  string `xml:"term,attr"`
+	Label string `xml:"label,attr"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+}
+
+var errUnknownFeedFormat = errors.New("unknown feed format")
+
+// maxFeedSize limits how much of a feed body is read into memory.
+const maxFeedSize = 10 << 20
+
+// parseFeed detects whether the document is RSS 2.0 or Atom and
+// returns its items.
+func parseFeed(r io.Reader) ([]FeedItem, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxFeedSize))
+	if err != nil {
+		return nil, err
+	}
+
+	root, err := rootElement(data)
+	if err != nil {
+		return nil, err
+	}
+
+	switch root {
+	case "rss":
+		return parseRSS(data)
+	case "feed":
+		return parseAtom(data)
+	default:
+		return nil, fmt.Errorf("%w: <%s>", errUnknownFeedFormat, root)
+	}
+}
+
+func rootElement(data []byte) (string, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return "", err
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			return start.Name.Local, nil
+		}
+	}
+}
+
+func parseRSS(data []byte) ([]FeedItem, error) {
+	var feed rssFeed
+	if err := xml.Unmarshal(data, &feed); err != nil {
+		return nil, err
+	}
+
+	items := make([]FeedItem, 0, len(feed.Channel.Items))
+	for _, item := range feed.Channel.Items {
+		content := item.Description
+		if strings.TrimSpace(content) == "" {
+			content = item.Encoded
+		}
+
+		guid := strings.TrimSpace(item.GUID)
+		if guid == "" {
+			guid = strings.TrimSpace(item.Link)
+		}
+
+		items = append(items, FeedItem{
+			GUID:        guid,
+			Title:       cleanText(item.Title),
+			Content:     cleanText(content),
+			Link:        strings.TrimSpace(item.Link),
+			PublishedAt: parseDate(item.PubDate),
+			Category:    itemCategory(item.Categories),
+		})
+	}
+	return items, nil
+}
+
+func parseAtom(data []byte) ([]FeedItem, error) {
+	var feed atomFeed
+	if err := xml.Unmarshal(data, &feed); err != nil {
+		return nil, err
+	}
+
+	items := make([]FeedItem, 0, len(feed.Entries))
+	for _, entry := range feed.Entries {
+		link := atomAlternateLink(entry.Links)
+
+		content := entry.Content
+		if strings.TrimSpace(content) == "" {
+			content = entry.Summary
+		}
+
+		guid := strings.TrimSpace(entry.ID)
+		if guid == "" {
+			guid = link
+		}
+
+		published := entry.Published
+		if published == "" {
+			published = entry.Updated
+		}
+
+		var categories []string
+		for _, category := range entry.Categories {
+			categories = append(categories, category.Term, category.Label)
+		}
+
+		items = append(items, FeedItem{
+			GUID:        guid,
+			Title:       cleanText(entry.Title),
+			Content:     cleanText(content),
+			Link:        link,
+			PublishedAt: parseDate(published),
+			Category:    itemCategory(categories),
+		})
+	}
+	return items, nil
+}
+
+func atomAlternateLink(links []atomLink) string {
+	for _, link := range links {
+		if link.Rel == "" || link.Rel == "alternate" {
+			return strings.TrimSpace(link.Href)
+		}
+	}
+	if len(links) > 0 {
+		return strings.TrimSpace(links[0].Href)
+	}
+	return ""
+}
+
+// categoryAliases maps category names commonly used by feeds to the
+// categories news can be filtered by.
+var categoryAliases = map[string]string{
+	"technology": "tech",
+	"технологии": "tech",
+	"economy":    "economics",
+	"business":   "economics",
+	"finance":    "economics",
+	"экономика":  "economics",
+	"бизнес":     "economics",
+	"финансы":    "economics",
+	"политика":   "politics",
+	"sport":      "sports",
+	"спорт":      "sports",
+	"arts":       "culture",
+	"культура":   "culture",
+}
+
+// itemCategory returns the first of an item's categories that maps to a
+// supported category, or "" to keep the category of the feed.
+func itemCategory(values []string) string {
+	for _, value := range values {
+		category := strings.ToLower(cleanText(value))
+		if alias, ok := categoryAliases[category]; ok {
+			category = alias
+		}
+		if validCategories[category] {
+			return category
+		}
+	}
+	return ""
+}
+
+var dateLayouts = []string{
+	time.RFC1123Z,
+	time.RFC1123,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04:05 MST",
+	"2 Jan 2006 15:04:05 -0700",
+	time.RFC3339,
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05",
+}
+
+// parseDate accepts the date formats commonly seen in RSS and Atom feeds.
+// Items without a parsable date are stamped with the current time.
+func parseDate(value string) time.Time {
+	value = strings.TrimSpace(value)
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.UTC()
+		}
+	}
+	return time.Now().UTC()
+}
+
+var (
+	tagPattern        = regexp.MustCompile(`<[^>]*>`)
+	whitespacePattern = regexp.MustCompile(`\s+`)
+)
+
+// cleanText strips HTML markup and collapses whitespace.
+func cleanText(s string) string {
+	s = tagPattern.ReplaceAllString(s, " ")
+	s = html.UnescapeString(s)
+	s = whitespacePattern.ReplaceAllString(s, " ")
+	return strings.TrimSpace(s)
+}
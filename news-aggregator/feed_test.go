@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRSS(t *testing.T) {
+	f, err := os.Open("testdata/rss.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	items, err := parseFeed(f)
+	if err != nil {
+		t.Fatalf("parseFeed returned error: %v", err)
+	}
+	if len(items) != 2 {
+		t.Fatalf("expected 2 items, got %d", len(items))
+	}
+
+	first := items[0]
+	if first.GUID != "tech-2024-01" {
+		t.Errorf("unexpected GUID: %q", first.GUID)
+	}
+	if first.Content != "Последние обновления в мире технологий & релизы." {
+		t.Errorf("unexpected content: %q", first.Content)
+	}
+	want := time.Date(2024, 1, 15, 7, 30, 0, 0, time.UTC)
+	if !first.PublishedAt.Equal(want) {
+		t.Errorf("unexpected date: got %v want %v", first.PublishedAt, want)
+	}
+
+	second := items[1]
+	if second.GUID != "https://example.com/news/sport" {
+		t.Errorf("expected link to be used as GUID, got %q", second.GUID)
+	}
+	if second.Content != "Результаты последних соревнований." {
+		t.Errorf("expected content:encoded fallback, got %q", second.Content)
+	}
+}
+
+func TestParseAtom(t *testing.T) {
+	f, err := os.Open("testdata/atom.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	items, err := parseFeed(f)
+	if err != nil {
+		t.Fatalf("parseFeed returned error: %v", err)
+	}
+	if len(items) != 2 {
+		t.Fatalf("expected 2 items, got %d", len(items))
+	}
+
+	if items[0].Link != "https://example.com/news/culture-1" {
+		t.Errorf("expected alternate link, got %q", items[0].Link)
+	}
+	if !items[0].PublishedAt.Equal(time.Date(2024, 1, 15, 6, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected published date: %v", items[0].PublishedAt)
+	}
+	if items[1].Content != "Обзор последних политических событий." {
+		t.Errorf("unexpected content: %q", items[1].Content)
+	}
+	if !items[1].PublishedAt.Equal(time.Date(2024, 1, 14, 8, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected updated date fallback, got %v", items[1].PublishedAt)
+	}
+}
+
+func TestParseFeedUnknownFormat(t *testing.T) {
+	if _, err := parseFeed(strings.NewReader("<html><body></body></html>")); err == nil {
+		t.Error("expected error for non-feed document")
+	}
+}
+
+func TestPollerStoresItemsWithStableIDs(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, "testdata/rss.xml")
+	}))
+	defer server.Close()
+
+	store := NewMemoryStore()
+	poller := NewPoller(store, time.Minute)
+
+	inserted, err := poller.Poll(context.Background(), Feed{URL: server.URL})
+	if err != nil {
+		t.Fatalf("Poll returned error: %v", err)
+	}
+	if inserted != 2 {
+		t.Errorf("expected 2 new items, got %d", inserted)
+	}
+
+	before, _, err := store.ListNews(context.Background(), NewsListing{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Polling the same feed again must not create duplicates or new IDs.
+	inserted, err = poller.Poll(context.Background(), Feed{URL: server.URL})
+	if err != nil {
+		t.Fatalf("Poll returned error: %v", err)
+	}
+	if inserted != 0 {
+		t.Errorf("expected no new items on second poll, got %d", inserted)
+	}
+
+	after, _, err := store.ListNews(context.Background(), NewsListing{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(after) != len(before) {
+		t.Fatalf("expected %d items, got %d", len(before), len(after))
+	}
+	for i := range before {
+		if before[i].ID != after[i].ID {
+			t.Errorf("ID changed between polls: %d != %d", before[i].ID, after[i].ID)
+		}
+	}
+}
+
+func TestPollerItemCategories(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, "testdata/categories.xml")
+	}))
+	defer server.Close()
+
+	store := NewMemoryStore()
+	poller := NewPoller(store, time.Minute)
+	if _, err := poller.Poll(context.Background(), Feed{URL: server.URL, Category: "tech"}); err != nil {
+		t.Fatalf("Poll returned error: %v", err)
+	}
+
+	news, _, err := store.ListNews(context.Background(), NewsListing{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Items naming a supported category keep it, the others fall back to
+	// the category of the feed.
+	want := map[string]string{
+		"Итоги матча":        "sports",
+		"Выборы в парламент": "politics",
+		"Курс рубля":         "economics",
+		"Прогноз погоды":     "tech",
+		"Новый смартфон":     "tech",
+	}
+	if len(news) != len(want) {
+		t.Fatalf("expected %d items, got %d", len(want), len(news))
+	}
+	for _, item := range news {
+		if item.Category != want[item.Title] {
+			t.Errorf("%s: got category %q want %q", item.Title, item.Category, want[item.Title])
+		}
+	}
+}
+
+func TestParseAtomCategories(t *testing.T) {
+	feed := `<feed xmlns="http://www.w3.org/2005/Atom">
+		<entry><id>1</id><title>Концерт</title><category term="arts" label="Искусство"/></entry>
+		<entry><id>2</id><title>Прогноз</title><category term="weather"/></entry>
+	</feed>`
+	items, err := parseFeed(strings.NewReader(feed))
+	if err != nil {
+		t.Fatalf("parseFeed returned error: %v", err)
+	}
+	if len(items) != 2 || items[0].Category != "culture" || items[1].Category != "" {
+		t.Errorf("unexpected categories: %+v", items)
+	}
+}
+
+func TestPollerCheckFreshness(t *testing.T) {
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, "testdata/rss.xml")
+	}))
+	defer up.Close()
+	down := httptest.NewServer(http.NotFoundHandler())
+	defer down.Close()
+
+	poller := NewPoller(NewMemoryStore(), 20*time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	pollers := poller.Start(ctx, []Feed{{URL: up.URL}, {URL: down.URL}})
+	defer func() {
+		cancel()
+		pollers.Wait()
+	}()
+
+	if err := poller.CheckFreshness(ctx); err != nil {
+		t.Errorf("expected feeds to be fresh right after startup, got %v", err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	err := poller.CheckFreshness(ctx)
+	if err == nil {
+		t.Fatal("expected the failing feed to be stale")
+	}
+	if !strings.Contains(err.Error(), down.URL) || strings.Contains(err.Error(), up.URL) {
+		t.Errorf("unexpected stale feeds: %v", err)
+	}
+}
@@ -1,272 +1,265 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
-	"os"
-	"os/signal"
+	"net/url"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
-	"github.com/go-chi/chi/v5/middleware"
+
+	"platform"
 )
 
-type Config struct {
-	Port string
-}
+// tracerName names the tracer of the spans started by the service.
+const tracerName = "news-aggregator"
 
-type Response struct {
-	Status     string      `json:"status"`
-	Data       interface{} `json:"data,omitempty"`
-	Error      string      `json:"error,omitempty"`
-	Pagination *Pagination `json:"pagination,omitempty"`
+type Config struct {
+	Port         string
+	Store        string
+	DBPath       string
+	Feeds        []Feed
+	PollInterval time.Duration
 }
 
-type Pagination struct {
-	Page      int `json:"page"`
-	PageSize  int `json:"page_size"`
-	Total     int `json:"total"`
-	TotalPages int `json:"total_pages"`
+type NewsItem struct {
+	ID               int               `json:"id"`
+	Title            string            `json:"title"`
+	Content          string            `json:"content"`
+	Link             string            `json:"link"`
+	Category         string            `json:"category,omitempty"`
+	Source           string            `json:"source"`
+	PublishedAt      time.Time         `json:"published_at"`
+	AlternateSources []AlternateSource `json:"alternate_sources,omitempty"`
 }
 
-type NewsItem struct {
-	ID      int    `json:"id"`
-	Title   string `json:"title"`
-	Content string `json:"content"`
-	Date    string `json:"date"`
+// AlternateSource is another feed that published the same story.
+type AlternateSource struct {
+	Feed string `json:"feed"`
+	Link string `json:"link"`
 }
 
 func main() {
+	platform.SetupLogging("news-aggregator")
+
+	pollInterval, err := time.ParseDuration(platform.GetEnv("NEWS_POLL_INTERVAL", "5m"))
+	if err != nil {
+		platform.Fatal("Invalid NEWS_POLL_INTERVAL", "error", err)
+	}
+
 	config := Config{
-		Port: getEnv("NEWS_AGGREGATOR_PORT", "8083"),
+		Port:         platform.GetEnv("NEWS_AGGREGATOR_PORT", "8083"),
+		Store:        platform.GetEnv("NEWS_STORE", "sqlite"),
+		DBPath:       platform.GetEnv("NEWS_DB_PATH", "./news.db"),
+		Feeds:        parseFeeds(platform.GetEnv("NEWS_FEEDS", "tech=https://habr.com/ru/rss/all/all/,https://lenta.ru/rss/news")),
+		PollInterval: pollInterval,
 	}
 
-	r := chi.NewRouter()
+	// Deferred first so spans of the pollers are flushed after they stop.
+	flushTraces := platform.SetupTracing("news-aggregator")
+	defer flushTraces()
 
-	// Middleware
-	r.Use(middleware.RequestID)
-	r.Use(middleware.RealIP)
-	r.Use(middleware.Logger)
-	r.Use(middleware.Recoverer)
+	store, err := newStore(config)
+	if err != nil {
+		platform.Fatal("Failed to initialize news store", "error", err)
+	}
+	defer store.Close()
 
-	// Routes
-	r.Get("/health", healthHandler)
-	r.Get("/news", getNewsHandler)
-	r.Get("/news/{id}", getNewsByIDHandler)
-
-	// Graceful shutdown
-	server := &http.Server{
-		Addr:    ":" + config.Port,
-		Handler: r,
+	index := NewSearchIndex()
+	store, err = newIndexedStore(context.Background(), store, index)
+	if err != nil {
+		platform.Fatal("Failed to build search index", "error", err)
 	}
 
-	done := make(chan os.Signal, 1)
-	signal.Notify(done, os.Interrupt)
-	go func() {
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("Server failed to start: %v", err)
-		}
-	}()
+	ctx, cancel := context.WithCancel(context.Background())
+	poller := NewPoller(store, config.PollInterval)
+	pollers := poller.Start(ctx, config.Feeds)
 
-	log.Printf("News Aggregator starting on port %s", config.Port)
-	<-done
-	log.Println("Server stopped gracefully")
-}
+	server := platform.NewServer("News Aggregator", config.Port)
+	// Stale feeds only degrade the service, stored news are still served.
+	server.AddHealthCheck(platform.HealthCheck{Name: "feeds", Check: poller.CheckFreshness, Optional: true})
+	r := server.Router
 
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+	// Routes
+	r.Get("/news", getNewsHandler(store, index))
+	r.Get("/news/{id}", getNewsByIDHandler(store))
+
+	slog.Info("Polling feeds", "feeds", len(config.Feeds), "interval", config.PollInterval.String())
+	if err := server.Run(); err != nil {
+		platform.Fatal("Server failed to start", "error", err)
 	}
-	return defaultValue
-}
 
-func healthHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(Response{Status: "ok"})
+	// Requests have drained, stop the pollers before the store is closed.
+	cancel()
+	pollers.Wait()
+	slog.Info("Feed pollers stopped")
 }
 
-func getNewsHandler(w http.ResponseWriter, r *http.Request) {
-	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
-	if page == 0 {
-		page = 1
-	}
-	pageSize, _ := strconv.Atoi(r.URL.Query().Get("page_size"))
-	if pageSize == 0 {
-		pageSize = 10
+// parseFeeds parses a comma separated list of feed URLs. Each URL may be
+// prefixed with the category of its news, as in "tech=https://...".
+func parseFeeds(value string) []Feed {
+	var feeds []Feed
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		feed := Feed{URL: part}
+		if i := strings.Index(part, "="); i > 0 && !strings.ContainsAny(part[:i], ":/") {
+			feed.Category = strings.ToLower(strings.TrimSpace(part[:i]))
+			feed.URL = strings.TrimSpace(part[i+1:])
+			if !validCategories[feed.Category] {
+				slog.Warn("Unknown feed category", "category", feed.Category, "feed", feed.URL)
+			}
+		}
+		feed.Source = feedSource(feed.URL)
+		feeds = append(feeds, feed)
 	}
-	search := r.URL.Query().Get("search")
+	return feeds
+}
 
-	// Generate mock news data
-	news := generateMockNews(page, pageSize, search)
+func getNewsHandler(store NewsStore, index *SearchIndex) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		page, pageSize, after, err := parsePageParams(r.URL.Query())
+		if err != nil {
+			platform.WriteError(w, r, http.StatusBadRequest, platform.CodeInvalidRequest, err.Error())
+			return
+		}
+		search := r.URL.Query().Get("search")
+		sortBy := r.URL.Query().Get("sort")
+		if sortBy != "" && sortBy != sortByDate && sortBy != sortByRelevance {
+			platform.WriteError(w, r, http.StatusBadRequest, platform.CodeInvalidRequest, "Invalid sort parameter")
+			return
+		}
+		// Relevance only makes sense for searches.
+		if sortBy == "" || search == "" {
+			sortBy = sortByDate
+		}
 
-	// Calculate pagination
-	total := len(news)
-	totalPages := (total + pageSize - 1) / pageSize
+		filter, err := parseNewsFilter(r.URL.Query())
+		if err != nil {
+			platform.WriteError(w, r, http.StatusBadRequest, platform.CodeInvalidRequest, err.Error())
+			return
+		}
 
-	response := Response{
-		Status: "success",
-		Data:   news,
-		Pagination: &Pagination{
-			Page:       page,
+		query := newsQuery{
+			Page:     page,
+			PageSize: pageSize,
+			Filter:   filter,
+			Search:   search,
+			Sort:     sortBy,
+		}
+		if after != "" {
+			cursor, err := decodeCursor(after)
+			if err != nil || cursor.Sort != sortBy {
+				platform.WriteError(w, r, http.StatusBadRequest, platform.CodeInvalidRequest, "Invalid after cursor")
+				return
+			}
+			query.After = cursor
+		}
+
+		result, err := queryNews(r.Context(), store, index, query)
+		if err != nil {
+			platform.Log(r.Context()).Error("Failed to fetch news", "error", err)
+			platform.WriteError(w, r, http.StatusInternalServerError, platform.CodeInternal, "Failed to fetch news")
+			return
+		}
+
+		// Calculate pagination
+		totalPages := (result.Total + pageSize - 1) / pageSize
+		pagination := &platform.Pagination{
 			PageSize:   pageSize,
-			Total:      total,
+			Total:      result.Total,
 			TotalPages: totalPages,
-		},
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
-}
+			NextCursor: result.NextCursor,
+		}
+		if query.After == nil {
+			pagination.Page = page
+		}
 
-func getNewsByIDHandler(w http.ResponseWriter, r *http.Request) {
-	idStr := chi.URLParam(r, "id")
-	id, err := strconv.Atoi(idStr)
-	if err != nil {
-		http.Error(w, "Invalid news ID", http.StatusBadRequest)
-		return
-	}
+		response := platform.Response{
+			Status:     "success",
+			Data:       result.Items,
+			Pagination: pagination,
+		}
 
-	// Find news by ID
-	news := findNewsByID(id)
-	if news == nil {
-		http.Error(w, "News not found", http.StatusNotFound)
-		return
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
 	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(news)
 }
 
-// Mock data generation functions
-func generateMockNews(page, pageSize int, search string) []NewsItem {
-	// Mock news data
-	mockNews := []NewsItem{
-		{
-			ID:      1,
-			Title:   "Новости технологий",
-			Content: "В этом выпуске: последние обновления в мире технологий, новые релизы и тренды.",
-			Date:    time.Now().Format("2006-01-02 15:04:05"),
-		},
-		{
-			ID:      2,
-			Title:   "Экономическая аналитика",
-			Content: "Анализ текущей экономической ситуации и прогнозы на ближайшие месяцы.",
-			Date:    time.Now().Add(-24 * time.Hour).Format("2006-01-02 15:04:05"),
-		},
-		{
-			ID:      3,
-			Title:   "Политические события",
-			Content: "Обзор последних политических событий в стране и за рубежом.",
-			Date:    time.Now().Add(-48 * time.Hour).Format("2006-01-02 15:04:05"),
-		},
-		{
-			ID:      4,
-			Title:   "Спортивные новости",
-			Content: "Результаты последних соревнований и интервью с известными спортсменами.",
-			Date:    time.Now().Add(-12 * time.Hour).Format("2006-01-02 15:04:05"),
-		},
-		{
-			ID:      5,
-			Title:   "Культура и искусство",
-			Content: "Открытие новых выставок, премьеры фильмов и театральных постановок.",
-			Date:    time.Now().Add(-36 * time.Hour).Format("2006-01-02 15:04:05"),
-		},
+// parseNewsFilter reads the category, source, from and to parameters.
+// Dates are either RFC 3339 timestamps or calendar days, a day passed as
+// "to" includes the whole day.
+func parseNewsFilter(query url.Values) (NewsFilter, error) {
+	filter := NewsFilter{
+		Category: strings.ToLower(query.Get("category")),
+		Source:   strings.ToLower(query.Get("source")),
+	}
+	if filter.Category != "" && !validCategories[filter.Category] {
+		return NewsFilter{}, fmt.Errorf("invalid category %q", filter.Category)
 	}
 
-	// Apply search filter if provided
-	if search != "" {
-		var filtered []NewsItem
-		for _, item := range mockNews {
-			if containsIgnoreCase(item.Title, search) || containsIgnoreCase(item.Content, search) {
-				filtered = append(filtered, item)
-			}
+	var err error
+	if value := query.Get("from"); value != "" {
+		if filter.From, _, err = parseFilterDate(value); err != nil {
+			return NewsFilter{}, errors.New("from must be a date (YYYY-MM-DD) or an RFC 3339 timestamp")
 		}
-		mockNews = filtered
 	}
-
-	// Apply pagination
-	start := (page - 1) * pageSize
-	if start >= len(mockNews) {
-		start = len(mockNews)
+	if value := query.Get("to"); value != "" {
+		to, isDay, err := parseFilterDate(value)
+		if err != nil {
+			return NewsFilter{}, errors.New("to must be a date (YYYY-MM-DD) or an RFC 3339 timestamp")
+		}
+		if isDay {
+			to = to.AddDate(0, 0, 1)
+		}
+		filter.To = to
 	}
-	end := start + pageSize
-	if end > len(mockNews) {
-		end = len(mockNews)
+	if !filter.From.IsZero() && !filter.To.IsZero() && !filter.From.Before(filter.To) {
+		return NewsFilter{}, errors.New("from must be before to")
 	}
 
-	return mockNews[start:end]
+	return filter, nil
 }
 
-func findNewsByID(id int) *NewsItem {
-	mockNews := []NewsItem{
-		{
-			ID:      1,
-			Title:   "Новости технологий",
-			Content: "В этом выпуске: последние обновления в мире технологий, новые релизы и тренды.",
-			Date:    time.Now().Format("2006-01-02 15:04:05"),
-		},
-		{
-			ID:      2,
-			Title:   "Экономическая аналитика",
-			Content: "Анализ текущей экономической ситуации и прогнозы на ближайшие месяцы.",
-			Date:    time.Now().Add(-24 * time.Hour).Format("2006-01-02 15:04:05"),
-		},
-		{
-			ID:      3,
-			Title:   "Политические события",
-			Content: "Обзор последних политических событий в стране и за рубежом.",
-			Date:    time.Now().Add(-48 * time.Hour).Format("2006-01-02 15:04:05"),
-		},
-		{
-			ID:      4,
-			Title:   "Спортивные новости",
-			Content: "Результаты последних соревнований и интервью с известными спортсменами.",
-			Date:    time.Now().Add(-12 * time.Hour).Format("2006-01-02 15:04:05"),
-		},
-		{
-			ID:      5,
-			Title:   "Культура и искусство",
-			Content: "Открытие новых выставок, премьеры фильмов и театральных постановок.",
-			Date:    time.Now().Add(-36 * time.Hour).Format("2006-01-02 15:04:05"),
-		},
-	}
-
-	for _, item := range mockNews {
-		if item.ID == id {
-			return &item
-		}
+func parseFilterDate(value string) (time.Time, bool, error) {
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, true, nil
 	}
-	return nil
-}
-
-func containsIgnoreCase(s, substr string) bool {
-	return contains(s, substr) || contains(s, toLower(substr))
+	t, err := time.Parse(time.RFC3339, value)
+	return t, false, err
 }
 
-func contains(s, substr string) bool {
-	return len(s) >= len(substr) && (s == substr || len(substr) == 0 || indexOf(s, substr) >= 0)
-}
-
-func toLower(s string) string {
-	var result []byte
-	for i := 0; i < len(s); i++ {
-		c := s[i]
-		if c >= 'A' && c <= 'Z' {
-			result = append(result, c+('a'-'A'))
-		} else {
-			result = append(result, c)
+func getNewsByIDHandler(store NewsStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		idStr := chi.URLParam(r, "id")
+		id, err := strconv.Atoi(idStr)
+		if err != nil {
+			platform.WriteError(w, r, http.StatusBadRequest, platform.CodeInvalidRequest, "Invalid news ID")
+			return
 		}
-	}
-	return string(result)
-}
 
-func indexOf(s, substr string) int {
-	for i := 0; i <= len(s)-len(substr); i++ {
-		if s[i:i+len(substr)] == substr {
-			return i
+		// Find news by ID
+		news, err := store.GetNews(r.Context(), id)
+		if err == ErrNewsNotFound {
+			platform.WriteError(w, r, http.StatusNotFound, platform.CodeNotFound, "News not found")
+			return
 		}
+		if err != nil {
+			platform.Log(r.Context()).Error("Failed to fetch news", "error", err)
+			platform.WriteError(w, r, http.StatusInternalServerError, platform.CodeInternal, "Failed to fetch news")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(news)
 	}
-	return -1
-}
\ No newline at end of file
+}
@@ -1,37 +1,41 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"testing"
-)
+	"time"
 
-func TestHealthHandler(t *testing.T) {
-	req, err := http.NewRequest("GET", "/health", nil)
-	if err != nil {
-		t.Fatal(err)
-	}
+	"github.com/go-chi/chi/v5"
 
-	rr := httptest.NewRecorder()
-	handler := http.HandlerFunc(healthHandler)
+	"platform"
+)
 
-	handler.ServeHTTP(rr, req)
+func newTestStore(t *testing.T) NewsStore {
+	t.Helper()
 
-	if status := rr.Code; status != http.StatusOK {
-		t.Errorf("handler returned wrong status code: got %v want %v",
-			status, http.StatusOK)
+	store, err := NewSQLiteStore(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
 	}
+	t.Cleanup(func() { store.Close() })
 
-	var response Response
-	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
-		t.Errorf("could not unmarshal response: %v", err)
+	items := []FeedItem{
+		{GUID: "tech-1", Title: "Новости технологий", Content: "Последние обновления в мире технологий.", Link: "https://example.com/tech-1", PublishedAt: time.Now().Add(-1 * time.Hour)},
+		{GUID: "economy-1", Title: "Экономическая аналитика", Content: "Анализ текущей экономической ситуации.", Link: "https://example.com/economy-1", PublishedAt: time.Now().Add(-24 * time.Hour)},
 	}
-
-	if response.Status != "ok" {
-		t.Errorf("handler returned unexpected body: got %v want %v",
-			response.Status, "ok")
+	if _, err := saveItems(context.Background(), store, items); err != nil {
+		t.Fatalf("Failed to seed database: %v", err)
 	}
+	return store
+}
+
+func withURLParam(req *http.Request, key, value string) *http.Request {
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add(key, value)
+	return req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
 }
 
 func TestGetNewsHandler(t *testing.T) {
@@ -41,7 +45,7 @@ func TestGetNewsHandler(t *testing.T) {
 	}
 
 	rr := httptest.NewRecorder()
-	handler := http.HandlerFunc(getNewsHandler)
+	handler := getNewsHandler(newTestStore(t), NewSearchIndex())
 
 	handler.ServeHTTP(rr, req)
 
@@ -50,7 +54,7 @@ func TestGetNewsHandler(t *testing.T) {
 			status, http.StatusOK)
 	}
 
-	var response Response
+	var response platform.Response
 	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
 		t.Errorf("could not unmarshal response: %v", err)
 	}
@@ -66,9 +70,10 @@ func TestGetNewsByIDHandler(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
+	req = withURLParam(req, "id", "1")
 
 	rr := httptest.NewRecorder()
-	handler := http.HandlerFunc(getNewsByIDHandler)
+	handler := getNewsByIDHandler(newTestStore(t))
 
 	handler.ServeHTTP(rr, req)
 
@@ -86,4 +91,98 @@ func TestGetNewsByIDHandler(t *testing.T) {
 		t.Errorf("handler returned unexpected news ID: got %v want %v",
 			news.ID, 1)
 	}
-}
\ No newline at end of file
+}
+
+func TestGetNewsByIDHandlerNotFound(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/news/100", nil)
+	req = withURLParam(req, "id", "100")
+
+	rr := httptest.NewRecorder()
+	getNewsByIDHandler(newTestStore(t)).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("handler returned wrong status code: got %v want %v",
+			rr.Code, http.StatusNotFound)
+	}
+}
+
+func TestParseFeeds(t *testing.T) {
+	feeds := parseFeeds("tech=https://habr.com/ru/rss/all/all/, https://www.lenta.ru/rss/news ,,https://example.com/rss?a=b")
+
+	want := []Feed{
+		{URL: "https://habr.com/ru/rss/all/all/", Category: "tech", Source: "habr.com"},
+		{URL: "https://www.lenta.ru/rss/news", Source: "lenta.ru"},
+		{URL: "https://example.com/rss?a=b", Source: "example.com"},
+	}
+	if len(feeds) != len(want) {
+		t.Fatalf("expected %d feeds, got %+v", len(want), feeds)
+	}
+	for i := range want {
+		if feeds[i] != want[i] {
+			t.Errorf("feed %d: got %+v want %+v", i, feeds[i], want[i])
+		}
+	}
+}
+
+func TestGetNewsHandlerFilters(t *testing.T) {
+	day := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+	items := []FeedItem{
+		{GUID: "1", Category: "tech", Source: "habr.com", Title: "Новости технологий", Link: "https://example.com/1", PublishedAt: day},
+		{GUID: "2", Category: "economics", Source: "lenta.ru", Title: "Экономическая аналитика", Link: "https://example.com/2", PublishedAt: day.Add(-24 * time.Hour)},
+		{GUID: "3", Category: "sports", Source: "lenta.ru", Title: "Спортивные новости", Link: "https://example.com/3", PublishedAt: day.Add(-48 * time.Hour)},
+	}
+
+	for name, store := range storeImplementations(t) {
+		t.Run(name, func(t *testing.T) {
+			if _, err := saveItems(context.Background(), store, items); err != nil {
+				t.Fatal(err)
+			}
+			handler := getNewsHandler(store, NewSearchIndex())
+
+			tests := []struct {
+				url  string
+				code int
+				want []string
+			}{
+				{"/news?category=tech", http.StatusOK, []string{"Новости технологий"}},
+				{"/news?category=TECH", http.StatusOK, []string{"Новости технологий"}},
+				{"/news?source=lenta.ru", http.StatusOK, []string{"Экономическая аналитика", "Спортивные новости"}},
+				{"/news?from=2024-01-14", http.StatusOK, []string{"Новости технологий", "Экономическая аналитика"}},
+				{"/news?to=2024-01-14", http.StatusOK, []string{"Экономическая аналитика", "Спортивные новости"}},
+				{"/news?from=2024-01-14&to=2024-01-14", http.StatusOK, []string{"Экономическая аналитика"}},
+				{"/news?from=2024-01-15T00:00:00Z&source=lenta.ru", http.StatusOK, []string{}},
+				{"/news?category=weather", http.StatusBadRequest, nil},
+				{"/news?from=yesterday", http.StatusBadRequest, nil},
+				{"/news?from=2024-01-15&to=2024-01-14", http.StatusBadRequest, nil},
+			}
+
+			for _, tt := range tests {
+				code, response := getNewsList(t, handler, tt.url)
+				if code != tt.code {
+					t.Errorf("%s: got status %d want %d", tt.url, code, tt.code)
+					continue
+				}
+				if code != http.StatusOK {
+					continue
+				}
+				got := []string{}
+				for _, item := range response.Data {
+					got = append(got, item.Title)
+				}
+				if len(got) != len(tt.want) {
+					t.Errorf("%s: got %v want %v", tt.url, got, tt.want)
+					continue
+				}
+				for i := range got {
+					if got[i] != tt.want[i] {
+						t.Errorf("%s: got %v want %v", tt.url, got, tt.want)
+						break
+					}
+				}
+				if response.Pagination.Total != len(tt.want) {
+					t.Errorf("%s: unexpected total %d", tt.url, response.Pagination.Total)
+				}
+			}
+		})
+	}
+}
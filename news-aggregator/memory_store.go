@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryStore is a NewsStore kept entirely in memory. It is meant for
+// tests and local runs where persistence is not needed.
+type MemoryStore struct {
+	mutex   sync.RWMutex
+	nextID  int
+	stories map[int]*memoryStory
+	guids   map[string]bool
+	// links holds the non-empty links of stories, which are unique like
+	// in the SQLite store.
+	links map[string]bool
+}
+
+type memoryStory struct {
+	item NewsItem
+	// sources holds the feed and canonical link of the story and of
+	// every alternate source.
+	sources []memorySource
+}
+
+type memorySource struct {
+	feed          string
+	canonicalLink string
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		nextID:  1,
+		stories: make(map[int]*memoryStory),
+		guids:   make(map[string]bool),
+		links:   make(map[string]bool),
+	}
+}
+
+func (s *MemoryStore) HasGUID(ctx context.Context, guidHash string) (bool, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.guids[guidHash], nil
+}
+
+func (s *MemoryStore) FindDuplicate(ctx context.Context, candidate newsCandidate) (int, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	if candidate.CanonicalLink != "" {
+		for _, id := range s.sortedIDs() {
+			for _, source := range s.stories[id].sources {
+				if source.canonicalLink == candidate.CanonicalLink {
+					return id, nil
+				}
+			}
+		}
+	}
+
+	for _, id := range s.sortedIDs() {
+		story := s.stories[id]
+		if withinDuplicateWindow(story.item.PublishedAt, candidate.PublishedAt) && similarTitles(story.item.Title, candidate.Title) {
+			return id, nil
+		}
+	}
+
+	return 0, ErrNewsNotFound
+}
+
+func (s *MemoryStore) InsertNews(ctx context.Context, candidate newsCandidate) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// Another poller may have stored the same story in the meantime.
+	if s.guids[candidate.GUIDHash] || (candidate.Link != "" && s.links[candidate.Link]) {
+		return 0, errNewsExists
+	}
+
+	id := s.nextID
+	s.nextID++
+	s.stories[id] = &memoryStory{
+		item: NewsItem{
+			ID:       id,
+			Title:    candidate.Title,
+			Content:  candidate.Content,
+			Link:     candidate.Link,
+			Category: candidate.Category,
+			Source:   candidate.Source,
+			// Match the precision of the SQLite store.
+			PublishedAt: candidate.PublishedAt.UTC().Truncate(time.Second),
+		},
+		sources: []memorySource{{feed: candidate.Feed, canonicalLink: candidate.CanonicalLink}},
+	}
+	s.guids[candidate.GUIDHash] = true
+	if candidate.Link != "" {
+		s.links[candidate.Link] = true
+	}
+	return id, nil
+}
+
+func (s *MemoryStore) AddSource(ctx context.Context, newsID int, candidate newsCandidate) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	story, ok := s.stories[newsID]
+	if !ok {
+		return ErrNewsNotFound
+	}
+
+	source := memorySource{feed: candidate.Feed, canonicalLink: candidate.CanonicalLink}
+	for _, known := range story.sources {
+		if known == source {
+			return nil
+		}
+	}
+
+	story.sources = append(story.sources, source)
+	story.item.AlternateSources = append(story.item.AlternateSources, AlternateSource{
+		Feed: candidate.Feed,
+		Link: candidate.Link,
+	})
+	s.guids[candidate.GUIDHash] = true
+	return nil
+}
+
+func (s *MemoryStore) ListNews(ctx context.Context, listing NewsListing) ([]NewsItem, int, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	ids := s.sortedIDs()
+	sort.SliceStable(ids, func(i, j int) bool {
+		return s.stories[ids[i]].item.PublishedAt.After(s.stories[ids[j]].item.PublishedAt)
+	})
+
+	news := make([]NewsItem, 0, len(ids))
+	for _, id := range ids {
+		if item := s.stories[id].item; listing.Filter.Match(item) {
+			news = append(news, s.stories[id].copyItem())
+		}
+	}
+	page, total := listing.page(news)
+	return page, total, nil
+}
+
+func (s *MemoryStore) GetNews(ctx context.Context, id int) (*NewsItem, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	story, ok := s.stories[id]
+	if !ok {
+		return nil, ErrNewsNotFound
+	}
+	item := story.copyItem()
+	return &item, nil
+}
+
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+// sortedIDs returns story IDs newest first. Callers must hold the mutex.
+func (s *MemoryStore) sortedIDs() []int {
+	ids := make([]int, 0, len(s.stories))
+	for id := range s.stories {
+		ids = append(ids, id)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(ids)))
+	return ids
+}
+
+// copyItem returns the item with its own copy of the alternate sources.
+func (story *memoryStory) copyItem() NewsItem {
+	item := story.item
+	item.AlternateSources = append([]AlternateSource(nil), story.item.AlternateSources...)
+	return item
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+const (
+	defaultPageSize = 10
+	maxPageSize     = 100
+	// maxPage keeps the offset of page-based listings small; deeper
+	// pages are reached with cursors.
+	maxPage = 10000
+)
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// newsCursor marks the last item of a page so the next page can continue
+// after it even when new items are inserted in between. It is sent to
+// clients as an opaque string.
+type newsCursor struct {
+	Sort  string  `json:"s"`
+	Time  int64   `json:"t,omitempty"`
+	Score float64 `json:"r,omitempty"`
+	ID    int     `json:"i"`
+}
+
+func (c newsCursor) encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(value string) (*newsCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+	var c newsCursor
+	if err := json.Unmarshal(data, &c); err != nil || c.ID <= 0 {
+		return nil, errInvalidCursor
+	}
+	if c.Sort != sortByDate && c.Sort != sortByRelevance {
+		return nil, errInvalidCursor
+	}
+	return &c, nil
+}
+
+// after reports whether a listed item comes after the cursor in the
+// listing order. Both orders are descending with the ID as tie-breaker.
+func (c newsCursor) after(item NewsItem, score float64) bool {
+	if c.Sort == sortByRelevance {
+		if score != c.Score {
+			return score < c.Score
+		}
+		return item.ID < c.ID
+	}
+	if t := item.PublishedAt.UnixNano(); t != c.Time {
+		return t < c.Time
+	}
+	return item.ID < c.ID
+}
+
+// parsePageParams reads and validates page, page_size and after.
+// Missing values fall back to defaults, page_size is capped at
+// maxPageSize and page may not exceed maxPage.
+func parsePageParams(query url.Values) (page, pageSize int, after string, err error) {
+	page, pageSize = 1, defaultPageSize
+
+	if value := query.Get("page"); value != "" {
+		page, err = strconv.Atoi(value)
+		if err != nil || page < 1 {
+			return 0, 0, "", errors.New("page must be a positive integer")
+		}
+		if page > maxPage {
+			return 0, 0, "", fmt.Errorf("page must not exceed %d, use after to go further", maxPage)
+		}
+	}
+
+	if value := query.Get("page_size"); value != "" {
+		pageSize, err = strconv.Atoi(value)
+		if err != nil || pageSize < 1 {
+			return 0, 0, "", errors.New("page_size must be a positive integer")
+		}
+		if pageSize > maxPageSize {
+			pageSize = maxPageSize
+		}
+	}
+
+	after = query.Get("after")
+	if after != "" && query.Get("page") != "" {
+		return 0, 0, "", errors.New("page and after cannot be combined")
+	}
+
+	return page, pageSize, after, nil
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"platform"
+)
+
+func newPaginationTestStore(t *testing.T, base NewsStore, count int) (NewsStore, *SearchIndex) {
+	t.Helper()
+
+	index := NewSearchIndex()
+	store, err := newIndexedStore(context.Background(), base, index)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	var items []FeedItem
+	for i := 1; i <= count; i++ {
+		items = append(items, FeedItem{
+			GUID:        fmt.Sprintf("item-%d", i),
+			Title:       fmt.Sprintf("Новость номер %d", i),
+			Content:     "Текст новости.",
+			Link:        fmt.Sprintf("https://example.com/%d", i),
+			PublishedAt: now.Add(time.Duration(i) * time.Minute),
+		})
+	}
+	if _, err := saveItems(context.Background(), store, items); err != nil {
+		t.Fatal(err)
+	}
+	return store, index
+}
+
+type newsListResponse struct {
+	Status     string               `json:"status"`
+	Data       []NewsItem           `json:"data"`
+	Pagination *platform.Pagination `json:"pagination"`
+}
+
+func getNewsList(t *testing.T, handler http.Handler, url string) (int, newsListResponse) {
+	t.Helper()
+
+	req, _ := http.NewRequest("GET", url, nil)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	var response newsListResponse
+	if rr.Code == http.StatusOK {
+		if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+			t.Fatalf("could not unmarshal response: %v", err)
+		}
+	}
+	return rr.Code, response
+}
+
+func TestPaginationTotals(t *testing.T) {
+	for name, base := range storeImplementations(t) {
+		t.Run(name, func(t *testing.T) {
+			handler := getNewsHandler(newPaginationTestStore(t, base, 25))
+
+			code, response := getNewsList(t, handler, "/news?page=3&page_size=10")
+			if code != http.StatusOK {
+				t.Fatalf("unexpected status %d", code)
+			}
+			p := response.Pagination
+			if p.Total != 25 || p.TotalPages != 3 || p.Page != 3 || p.PageSize != 10 {
+				t.Errorf("unexpected pagination: %+v", p)
+			}
+			if len(response.Data) != 5 {
+				t.Errorf("expected 5 items on the last page, got %d", len(response.Data))
+			}
+			if p.NextCursor != "" {
+				t.Errorf("expected no next cursor on the last page, got %q", p.NextCursor)
+			}
+
+			// Totals count the whole filtered result, not the page.
+			code, response = getNewsList(t, handler, "/news?page_size=2&search=номер")
+			if code != http.StatusOK {
+				t.Fatalf("unexpected status %d", code)
+			}
+			if response.Pagination.Total != 25 || response.Pagination.TotalPages != 13 {
+				t.Errorf("unexpected pagination for search: %+v", response.Pagination)
+			}
+		})
+	}
+}
+
+func TestPaginationValidation(t *testing.T) {
+	handler := getNewsHandler(newPaginationTestStore(t, NewMemoryStore(), 3))
+
+	tests := []struct {
+		url  string
+		code int
+	}{
+		{"/news?page=0", http.StatusBadRequest},
+		{"/news?page=-1", http.StatusBadRequest},
+		{"/news?page=abc", http.StatusBadRequest},
+		{"/news?page_size=0", http.StatusBadRequest},
+		{"/news?page_size=-5", http.StatusBadRequest},
+		{"/news?after=not-a-cursor", http.StatusBadRequest},
+		{"/news?page=1&after=" + (newsCursor{Sort: sortByDate, ID: 1}).encode(), http.StatusBadRequest},
+		{"/news?page=10", http.StatusOK},
+		{"/news?page=10000&page_size=100", http.StatusOK},
+		{"/news?page=10001", http.StatusBadRequest},
+		{"/news?page=1000000000000000000", http.StatusBadRequest},
+		{"/news?page=100000000000000000000", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if code, _ := getNewsList(t, handler, tt.url); code != tt.code {
+			t.Errorf("%s: got status %d want %d", tt.url, code, tt.code)
+		}
+	}
+
+	code, response := getNewsList(t, handler, "/news?page_size=1000")
+	if code != http.StatusOK {
+		t.Fatalf("unexpected status %d", code)
+	}
+	if response.Pagination.PageSize != maxPageSize {
+		t.Errorf("expected page_size to be capped at %d, got %d", maxPageSize, response.Pagination.PageSize)
+	}
+}
+
+func TestListNewsOffsetBounds(t *testing.T) {
+	for name, base := range storeImplementations(t) {
+		t.Run(name, func(t *testing.T) {
+			store, _ := newPaginationTestStore(t, base, 3)
+			tests := []struct {
+				offset int
+				want   int
+			}{
+				{-1, 2},
+				{2, 1},
+				{3, 0},
+				{1 << 40, 0},
+			}
+			for _, tt := range tests {
+				news, total, err := store.ListNews(context.Background(), NewsListing{Offset: tt.offset, Limit: 2})
+				if err != nil {
+					t.Fatalf("offset %d: %v", tt.offset, err)
+				}
+				if total != 3 || len(news) != tt.want {
+					t.Errorf("offset %d: got %d items of %d, want %d of 3", tt.offset, len(news), total, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestCursorPagination(t *testing.T) {
+	for name, base := range storeImplementations(t) {
+		t.Run(name, func(t *testing.T) {
+			store, index := newPaginationTestStore(t, base, 7)
+			handler := getNewsHandler(store, index)
+			if _, response := getNewsList(t, handler, "/news?page_size=3"); response.Pagination.Total != 7 {
+				t.Errorf("unexpected total %d", response.Pagination.Total)
+			}
+
+			ids := followCursors(t, handler, "/news?page_size=3", func(pages int) {
+				if pages == 0 {
+					// New items must not shift the following pages.
+					newer := []FeedItem{{GUID: "newest", Title: "Свежая новость", Link: "https://example.com/new", PublishedAt: time.Now().Add(time.Hour)}}
+					if _, err := saveItems(context.Background(), store, newer); err != nil {
+						t.Fatal(err)
+					}
+				}
+			})
+			if want := []int{7, 6, 5, 4, 3, 2, 1}; !equalIDs(ids, want) {
+				t.Errorf("got IDs %v want %v", ids, want)
+			}
+
+			// Relevance ties are broken by ID, and a filter narrows the
+			// matches.
+			ids = followCursors(t, handler, "/news?page_size=2&search=номер&sort=relevance", nil)
+			if want := []int{7, 6, 5, 4, 3, 2, 1}; !equalIDs(ids, want) {
+				t.Errorf("relevance: got IDs %v want %v", ids, want)
+			}
+			from := time.Now().Add(4*time.Minute + 30*time.Second).UTC().Format(time.RFC3339)
+			ids = followCursors(t, handler, "/news?page_size=2&search=номер&from="+from, nil)
+			if want := []int{7, 6, 5}; !equalIDs(ids, want) {
+				t.Errorf("filtered search: got IDs %v want %v", ids, want)
+			}
+		})
+	}
+}
+
+// followCursors lists news from url page by page and returns the IDs in
+// the order seen. visit, if set, runs after each page.
+func followCursors(t *testing.T, handler http.Handler, url string, visit func(pages int)) []int {
+	t.Helper()
+
+	var ids []int
+	next := url
+	for pages := 0; ; pages++ {
+		if pages > 5 {
+			t.Fatal("cursor pagination did not terminate")
+		}
+		code, response := getNewsList(t, handler, next)
+		if code != http.StatusOK {
+			t.Fatalf("%s: unexpected status %d", next, code)
+		}
+		for _, item := range response.Data {
+			ids = append(ids, item.ID)
+		}
+		if visit != nil {
+			visit(pages)
+		}
+
+		if response.Pagination.NextCursor == "" {
+			return ids
+		}
+		next = url + "&after=" + response.Pagination.NextCursor
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"platform"
+)
+
+var (
+	feedPolls = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "feed_polls_total",
+		Help: "Feed polls by feed and result: success or failure.",
+	}, []string{"feed", "result"})
+	feedItemsInserted = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "feed_items_inserted_total",
+		Help: "New items stored by feed.",
+	}, []string{"feed"})
+)
+
+// Feed is a configured news feed.
+type Feed struct {
+	URL string
+	// Category is given to items that do not name a supported category
+	// themselves.
+	Category string
+	// Source is the name news from this feed are filtered by.
+	Source string
+}
+
+// feedSource derives a source name from the feed host.
+func feedSource(feedURL string) string {
+	u, err := url.Parse(feedURL)
+	if err != nil || u.Hostname() == "" {
+		return feedURL
+	}
+	return strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+}
+
+// Poller periodically fetches feeds and stores their items.
+type Poller struct {
+	store    NewsStore
+	client   *http.Client
+	interval time.Duration
+
+	mutex   sync.Mutex
+	started time.Time
+	feeds   []Feed
+	// polled holds the last successful poll of every feed.
+	polled map[string]time.Time
+}
+
+func NewPoller(store NewsStore, interval time.Duration) *Poller {
+	return &Poller{
+		store:    store,
+		client:   &http.Client{Timeout: 30 * time.Second},
+		interval: interval,
+		polled:   make(map[string]time.Time),
+	}
+}
+
+// Start launches one goroutine per feed. The returned WaitGroup is done
+// once all pollers have exited after ctx is cancelled.
+func (p *Poller) Start(ctx context.Context, feeds []Feed) *sync.WaitGroup {
+	p.mutex.Lock()
+	p.started = time.Now()
+	p.feeds = feeds
+	p.mutex.Unlock()
+
+	var wg sync.WaitGroup
+	for _, feed := range feeds {
+		wg.Add(1)
+		go func(feed Feed) {
+			defer wg.Done()
+			p.run(ctx, feed)
+		}(feed)
+	}
+	return &wg
+}
+
+func (p *Poller) run(ctx context.Context, feed Feed) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		inserted, err := p.Poll(ctx, feed)
+		if err != nil {
+			slog.Error("Failed to poll feed", "feed", feed.URL, "error", err)
+			feedPolls.WithLabelValues(feed.URL, "failure").Inc()
+		} else {
+			slog.Info("Polled feed", "feed", feed.URL, "inserted", inserted)
+			feedPolls.WithLabelValues(feed.URL, "success").Inc()
+			feedItemsInserted.WithLabelValues(feed.URL).Add(float64(inserted))
+			p.mutex.Lock()
+			p.polled[feed.URL] = time.Now()
+			p.mutex.Unlock()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Poll fetches a single feed once and returns the number of new items. Each
+// poll is the root span of a trace.
+func (p *Poller) Poll(ctx context.Context, feed Feed) (inserted int, err error) {
+	ctx, span := otel.Tracer(tracerName).Start(ctx, "poll feed", trace.WithAttributes(attribute.String("feed.url", feed.URL)))
+	defer func() {
+		span.SetAttributes(attribute.Int("feed.inserted", inserted))
+		platform.RecordError(span, err)
+		span.End()
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, feed.URL, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Accept", "application/rss+xml, application/atom+xml, application/xml, text/xml")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	items, err := parseFeed(resp.Body)
+	if err != nil {
+		return 0, err
+	}
+
+	for i := range items {
+		items[i].Feed = feed.URL
+		if items[i].Category == "" {
+			items[i].Category = feed.Category
+		}
+		items[i].Source = feed.Source
+	}
+
+	return saveItems(ctx, p.store, items)
+}
+
+// CheckFreshness reports feeds that have not been polled successfully for
+// three poll intervals, counting from startup for feeds never polled.
+func (p *Poller) CheckFreshness(ctx context.Context) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	maxAge := 3 * p.interval
+	var stale []string
+	for _, feed := range p.feeds {
+		last, ok := p.polled[feed.URL]
+		if !ok {
+			last = p.started
+		}
+		if time.Since(last) > maxAge {
+			stale = append(stale, feed.URL)
+		}
+	}
+	if len(stale) > 0 {
+		return fmt.Errorf("no successful poll in %s: %s", maxAge, strings.Join(stale, ", "))
+	}
+	return nil
+}
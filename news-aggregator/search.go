@@ -0,0 +1,344 @@
+package main
+
+import (
+	"context"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// BM25 ranking parameters.
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+	// titleBoost weights a term found in the title against the content.
+	titleBoost = 2
+)
+
+// SearchIndex is an in-memory inverted index over news titles and content.
+type SearchIndex struct {
+	mutex sync.RWMutex
+	// postings maps a stem to the documents containing it.
+	postings map[string]map[int]*posting
+	// words maps every indexed word to its stem for prefix queries,
+	// sortedWords keeps the same words ordered for range scans.
+	words       map[string]string
+	sortedWords []string
+	docLengths  map[int]int
+	totalLength int
+}
+
+type posting struct {
+	positions []int
+	titleHits int
+}
+
+// SearchResult is a matching document with its relevance score.
+type SearchResult struct {
+	ID    int
+	Score float64
+}
+
+func NewSearchIndex() *SearchIndex {
+	return &SearchIndex{
+		postings:   make(map[string]map[int]*posting),
+		words:      make(map[string]string),
+		docLengths: make(map[int]int),
+	}
+}
+
+// token is an analyzed word with its position in the document.
+type token struct {
+	word     string
+	stem     string
+	position int
+}
+
+// foldCase lowercases text with Unicode rules and folds "ё" into "е".
+func foldCase(text string) string {
+	return strings.ReplaceAll(strings.ToLower(text), "ё", "е")
+}
+
+// analyze splits text into case-folded, stemmed tokens. Positions start
+// at offset so several fields can share one position space.
+func analyze(text string, offset int) []token {
+	words := strings.FieldsFunc(foldCase(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	tokens := make([]token, 0, len(words))
+	for i, word := range words {
+		tokens = append(tokens, token{word: word, stem: stem(word), position: offset + i})
+	}
+	return tokens
+}
+
+// Add indexes a document. Re-adding an ID replaces the old document.
+func (idx *SearchIndex) Add(id int, title, content string) {
+	idx.mutex.Lock()
+	defer idx.mutex.Unlock()
+
+	idx.remove(id)
+
+	titleTokens := analyze(title, 0)
+	// Leave a gap so phrases never span title and content.
+	contentTokens := analyze(content, len(titleTokens)+1)
+
+	for i, tokens := range [][]token{titleTokens, contentTokens} {
+		for _, t := range tokens {
+			docs, ok := idx.postings[t.stem]
+			if !ok {
+				docs = make(map[int]*posting)
+				idx.postings[t.stem] = docs
+			}
+			p, ok := docs[id]
+			if !ok {
+				p = &posting{}
+				docs[id] = p
+			}
+			p.positions = append(p.positions, t.position)
+			if i == 0 {
+				p.titleHits++
+			}
+
+			if _, ok := idx.words[t.word]; !ok {
+				idx.words[t.word] = t.stem
+				idx.insertWord(t.word)
+			}
+		}
+	}
+
+	length := len(titleTokens) + len(contentTokens)
+	idx.docLengths[id] = length
+	idx.totalLength += length
+}
+
+// insertWord keeps sortedWords ordered. Callers must hold the mutex.
+func (idx *SearchIndex) insertWord(word string) {
+	i := sort.SearchStrings(idx.sortedWords, word)
+	idx.sortedWords = append(idx.sortedWords, "")
+	copy(idx.sortedWords[i+1:], idx.sortedWords[i:])
+	idx.sortedWords[i] = word
+}
+
+// remove drops a document from the index. Callers must hold the mutex.
+func (idx *SearchIndex) remove(id int) {
+	length, ok := idx.docLengths[id]
+	if !ok {
+		return
+	}
+	for stem, docs := range idx.postings {
+		delete(docs, id)
+		if len(docs) == 0 {
+			delete(idx.postings, stem)
+		}
+	}
+	delete(idx.docLengths, id)
+	idx.totalLength -= length
+}
+
+// queryClause is one required part of a search query: a single word, a
+// quoted phrase or a prefix ending with "*".
+type queryClause struct {
+	stems  []string
+	prefix string
+}
+
+// parseQuery splits a query into clauses. Text in double quotes is a
+// phrase, a word ending with "*" is a prefix, every other word is matched
+// by its stem.
+func parseQuery(query string) []queryClause {
+	var clauses []queryClause
+
+	parts := strings.Split(query, `"`)
+	for i, part := range parts {
+		// Odd parts are inside quotes. An unterminated quote is treated
+		// as a phrase up to the end of the query.
+		if i%2 == 1 {
+			tokens := analyze(part, 0)
+			if len(tokens) == 0 {
+				continue
+			}
+			clause := queryClause{}
+			for _, t := range tokens {
+				clause.stems = append(clause.stems, t.stem)
+			}
+			clauses = append(clauses, clause)
+			continue
+		}
+
+		for _, field := range strings.Fields(part) {
+			isPrefix := strings.HasSuffix(field, "*")
+			tokens := analyze(field, 0)
+			for j, t := range tokens {
+				// Only the last word of "foo-bar*" is a prefix.
+				if isPrefix && j == len(tokens)-1 {
+					clauses = append(clauses, queryClause{prefix: t.word})
+				} else {
+					clauses = append(clauses, queryClause{stems: []string{t.stem}})
+				}
+			}
+		}
+	}
+	return clauses
+}
+
+// Search returns documents matching every clause of the query, best
+// match first.
+func (idx *SearchIndex) Search(query string) []SearchResult {
+	clauses := parseQuery(query)
+	if len(clauses) == 0 {
+		return []SearchResult{}
+	}
+
+	idx.mutex.RLock()
+	defer idx.mutex.RUnlock()
+
+	var scores map[int]float64
+	for _, clause := range clauses {
+		clauseScores := idx.matchClause(clause)
+		if scores == nil {
+			scores = clauseScores
+			continue
+		}
+		for id := range scores {
+			if s, ok := clauseScores[id]; ok {
+				scores[id] += s
+			} else {
+				delete(scores, id)
+			}
+		}
+	}
+
+	results := make([]SearchResult, 0, len(scores))
+	for id, score := range scores {
+		results = append(results, SearchResult{ID: id, Score: score})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].ID > results[j].ID
+	})
+	return results
+}
+
+// matchClause returns the documents matching a clause with their BM25
+// score. Callers must hold the read lock.
+func (idx *SearchIndex) matchClause(clause queryClause) map[int]float64 {
+	scores := make(map[int]float64)
+
+	if clause.prefix != "" {
+		stems := make(map[string]bool)
+		start := sort.SearchStrings(idx.sortedWords, clause.prefix)
+		for _, word := range idx.sortedWords[start:] {
+			if !strings.HasPrefix(word, clause.prefix) {
+				break
+			}
+			stems[idx.words[word]] = true
+		}
+		for stem := range stems {
+			for id, score := range idx.scoreTerm(stem) {
+				scores[id] += score
+			}
+		}
+		return scores
+	}
+
+	if len(clause.stems) == 1 {
+		return idx.scoreTerm(clause.stems[0])
+	}
+
+	// Phrase: every stem must be present at consecutive positions.
+	first := idx.postings[clause.stems[0]]
+	for id, p := range first {
+		if idx.containsPhrase(id, p.positions, clause.stems[1:]) {
+			for _, stem := range clause.stems {
+				scores[id] += idx.bm25(stem, id)
+			}
+		}
+	}
+	return scores
+}
+
+func (idx *SearchIndex) containsPhrase(id int, starts []int, rest []string) bool {
+	for _, start := range starts {
+		matched := true
+		for offset, stem := range rest {
+			p, ok := idx.postings[stem][id]
+			if !ok || !containsInt(p.positions, start+offset+1) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+func containsInt(values []int, value int) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func (idx *SearchIndex) scoreTerm(stem string) map[int]float64 {
+	scores := make(map[int]float64, len(idx.postings[stem]))
+	for id := range idx.postings[stem] {
+		scores[id] = idx.bm25(stem, id)
+	}
+	return scores
+}
+
+// bm25 scores a single stem for a document.
+func (idx *SearchIndex) bm25(stem string, id int) float64 {
+	docs := idx.postings[stem]
+	p, ok := docs[id]
+	if !ok {
+		return 0
+	}
+
+	n := float64(len(idx.docLengths))
+	df := float64(len(docs))
+	idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+
+	tf := float64(len(p.positions) + (titleBoost-1)*p.titleHits)
+	avgLength := float64(idx.totalLength) / n
+	length := float64(idx.docLengths[id])
+	return idf * tf * (bm25K1 + 1) / (tf + bm25K1*(1-bm25B+bm25B*length/avgLength))
+}
+
+// indexedStore keeps a SearchIndex in sync with the stories it stores.
+type indexedStore struct {
+	NewsStore
+	index *SearchIndex
+}
+
+// newIndexedStore indexes every stored story and wraps the store so new
+// stories are indexed as they are inserted.
+func newIndexedStore(ctx context.Context, store NewsStore, index *SearchIndex) (NewsStore, error) {
+	news, _, err := store.ListNews(ctx, NewsListing{})
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range news {
+		index.Add(item.ID, item.Title, item.Content)
+	}
+	return &indexedStore{NewsStore: store, index: index}, nil
+}
+
+func (s *indexedStore) InsertNews(ctx context.Context, candidate newsCandidate) (int, error) {
+	id, err := s.NewsStore.InsertNews(ctx, candidate)
+	if err != nil {
+		return 0, err
+	}
+	s.index.Add(id, candidate.Title, candidate.Content)
+	return id, nil
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestStemRussian(t *testing.T) {
+	tests := map[string]string{
+		"новости":       "новост",
+		"новостей":      "новост",
+		"технологий":    "технолог",
+		"технологии":    "технолог",
+		"экономическая": "экономическ",
+		"экономической": "экономическ",
+		"спортивные":    "спортивн",
+		"выставок":      "выставок",
+		"выставки":      "выставк",
+	}
+	for word, want := range tests {
+		if got := stem(word); got != want {
+			t.Errorf("stem(%q) = %q, want %q", word, got, want)
+		}
+	}
+}
+
+func TestStemEnglish(t *testing.T) {
+	tests := map[string]string{
+		"caresses":     "caress",
+		"ponies":       "poni",
+		"running":      "run",
+		"hopping":      "hop",
+		"relational":   "relat",
+		"technologies": "technolog",
+		"technology":   "technolog",
+		"news":         "new",
+		"go":           "go",
+	}
+	for word, want := range tests {
+		if got := stem(word); got != want {
+			t.Errorf("stem(%q) = %q, want %q", word, got, want)
+		}
+	}
+}
+
+func newTestIndex() *SearchIndex {
+	index := NewSearchIndex()
+	index.Add(1, "Новости технологий", "Последние обновления в мире технологий, новые релизы и тренды.")
+	index.Add(2, "Экономическая аналитика", "Анализ текущей экономической ситуации и прогнозы.")
+	index.Add(3, "Спортивные новости", "Результаты последних соревнований.")
+	index.Add(4, "Technology news", "New releases from technology companies.")
+	return index
+}
+
+func resultIDs(results []SearchResult) []int {
+	ids := make([]int, 0, len(results))
+	for _, result := range results {
+		ids = append(ids, result.ID)
+	}
+	return ids
+}
+
+func equalIDs(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSearchIndex(t *testing.T) {
+	index := newTestIndex()
+
+	tests := []struct {
+		query string
+		want  []int
+	}{
+		// Unicode case folding and Russian stemming.
+		{"новости", []int{3, 1}},
+		{"НОВОСТЕЙ", []int{3, 1}},
+		{"технологии", []int{1}},
+		// Every word is required.
+		{"новости технологий", []int{1}},
+		// English stemming.
+		{"technologies", []int{4}},
+		// Phrases must match consecutive words.
+		{`"спортивные новости"`, []int{3}},
+		{`"новости спортивные"`, []int{}},
+		// Prefix queries.
+		{"эконом*", []int{2}},
+		{"tech*", []int{4}},
+		{"", []int{}},
+		{"несуществующее", []int{}},
+	}
+
+	for _, tt := range tests {
+		got := resultIDs(index.Search(tt.query))
+		if !equalIDs(got, tt.want) {
+			t.Errorf("Search(%q) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestSearchRanksTitleMatchesHigher(t *testing.T) {
+	index := NewSearchIndex()
+	index.Add(1, "Обзор рынка", "Ставка центробанка осталась прежней, рынок спокоен.")
+	index.Add(2, "Ставка центробанка", "Регулятор сохранил ставку.")
+
+	results := index.Search("ставка")
+	if len(results) != 2 || results[0].ID != 2 {
+		t.Errorf("expected document 2 to rank first, got %+v", results)
+	}
+}
+
+func TestGetNewsHandlerSearch(t *testing.T) {
+	store := NewMemoryStore()
+	now := time.Now()
+	items := []FeedItem{
+		{GUID: "1", Title: "Новости технологий", Content: "Обзор рынка.", Link: "https://example.com/1", PublishedAt: now.Add(-2 * time.Hour)},
+		{GUID: "2", Title: "Рынок технологий", Content: "Новости технологий и технологии новостей.", Link: "https://example.com/2", PublishedAt: now.Add(-1 * time.Hour)},
+		{GUID: "3", Title: "Спорт", Content: "Результаты матчей.", Link: "https://example.com/3", PublishedAt: now},
+	}
+
+	index := NewSearchIndex()
+	indexed, err := newIndexedStore(context.Background(), store, index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := saveItems(context.Background(), indexed, items); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		url  string
+		code int
+		want []string
+	}{
+		{"/news?search=новости", http.StatusOK, []string{"2", "1"}},
+		{"/news?search=Технологии&sort=relevance", http.StatusOK, []string{"2", "1"}},
+		{"/news?search=обзор", http.StatusOK, []string{"1"}},
+		{"/news?sort=popular", http.StatusBadRequest, nil},
+	}
+
+	for _, tt := range tests {
+		req, _ := http.NewRequest("GET", tt.url, nil)
+		rr := httptest.NewRecorder()
+		getNewsHandler(indexed, index).ServeHTTP(rr, req)
+
+		if rr.Code != tt.code {
+			t.Errorf("%s: got status %d want %d", tt.url, rr.Code, tt.code)
+			continue
+		}
+		if tt.code != http.StatusOK {
+			continue
+		}
+
+		var response struct {
+			Data []NewsItem `json:"data"`
+		}
+		if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+			t.Fatalf("could not unmarshal response: %v", err)
+		}
+		var got []string
+		for _, item := range response.Data {
+			got = append(got, item.Link[len("https://example.com/"):])
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: got %v want %v", tt.url, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%s: got %v want %v", tt.url, got, tt.want)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,470 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"platform"
+)
+
+// migrations are applied in order at startup. Never edit an applied
+// migration, append a new one instead.
+var migrations = []platform.Migration{
+	{
+		Version: 1,
+		Name:    "create news table",
+		Query: `
+		CREATE TABLE IF NOT EXISTS news (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			guid TEXT NOT NULL UNIQUE,
+			title TEXT NOT NULL,
+			content TEXT NOT NULL,
+			link TEXT NOT NULL,
+			published_at DATETIME NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);
+		CREATE INDEX IF NOT EXISTS idx_published_at ON news(published_at);
+		`,
+	},
+	{
+		Version: 2,
+		Name:    "unique news link",
+		Query: `
+		DELETE FROM news WHERE link != '' AND id NOT IN (SELECT MIN(id) FROM news WHERE link != '' GROUP BY link);
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_news_link ON news(link) WHERE link != '';
+		`,
+	},
+	{
+		Version: 3,
+		Name:    "deduplication keys and alternate sources",
+		Query: `
+		ALTER TABLE news ADD COLUMN guid_hash TEXT NOT NULL DEFAULT '';
+		ALTER TABLE news ADD COLUMN canonical_link TEXT NOT NULL DEFAULT '';
+		ALTER TABLE news ADD COLUMN feed TEXT NOT NULL DEFAULT '';
+		CREATE TABLE news_sources (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			news_id INTEGER NOT NULL,
+			guid_hash TEXT NOT NULL,
+			feed TEXT NOT NULL,
+			link TEXT NOT NULL,
+			canonical_link TEXT NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (news_id) REFERENCES news (id)
+		);
+		CREATE UNIQUE INDEX idx_news_sources_guid_hash ON news_sources(guid_hash);
+		CREATE INDEX idx_news_sources_news_id ON news_sources(news_id);
+		CREATE INDEX idx_news_sources_canonical_link ON news_sources(canonical_link);
+		`,
+		Backfill: backfillDedupKeys,
+	},
+	{
+		Version: 4,
+		Name:    "deduplication key indexes",
+		Query: `
+		CREATE UNIQUE INDEX idx_news_guid_hash ON news(guid_hash);
+		CREATE INDEX idx_news_canonical_link ON news(canonical_link);
+		`,
+	},
+	{
+		Version: 5,
+		Name:    "news category and source",
+		Query: `
+		ALTER TABLE news ADD COLUMN category TEXT NOT NULL DEFAULT '';
+		ALTER TABLE news ADD COLUMN source TEXT NOT NULL DEFAULT '';
+		CREATE INDEX idx_news_category ON news(category, published_at);
+		CREATE INDEX idx_news_source ON news(source, published_at);
+		`,
+		Backfill: backfillSources,
+	},
+}
+
+// backfillDedupKeys computes GUID hashes and canonical links for news
+// stored before deduplication existed.
+func backfillDedupKeys(tx *sql.Tx) error {
+	rows, err := tx.Query("SELECT id, guid, link FROM news")
+	if err != nil {
+		return err
+	}
+	type keys struct {
+		id                  int
+		guidHash, canonical string
+	}
+	var pending []keys
+	for rows.Next() {
+		var id int
+		var guid, link string
+		if err := rows.Scan(&id, &guid, &link); err != nil {
+			rows.Close()
+			return err
+		}
+		pending = append(pending, keys{id: id, guidHash: hashGUID(guid), canonical: canonicalizeLink(link)})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, k := range pending {
+		if _, err := tx.Exec("UPDATE news SET guid_hash = ?, canonical_link = ? WHERE id = ?", k.guidHash, k.canonical, k.id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// backfillSources derives the source of existing news from their feed.
+func backfillSources(tx *sql.Tx) error {
+	rows, err := tx.Query("SELECT DISTINCT feed FROM news WHERE feed != ''")
+	if err != nil {
+		return err
+	}
+	var feeds []string
+	for rows.Next() {
+		var feed string
+		if err := rows.Scan(&feed); err != nil {
+			rows.Close()
+			return err
+		}
+		feeds = append(feeds, feed)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, feed := range feeds {
+		if _, err := tx.Exec("UPDATE news SET source = ? WHERE feed = ?", feedSource(feed), feed); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// queryDuration records the latency of every SQLiteStore call, including
+// the rows it reads.
+var queryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "db_query_duration_seconds",
+	Help:    "SQLite query latency by query.",
+	Buckets: platform.QueryBuckets,
+}, []string{"query"})
+
+// startQuery times the named store call and traces it as a child of the
+// span in ctx. The returned function ends both.
+func startQuery(ctx context.Context, name string) func() {
+	start := time.Now()
+	_, span := otel.Tracer(tracerName).Start(ctx, "sqlite "+name, trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("db.system", "sqlite"), attribute.String("db.operation", name)))
+	return func() {
+		queryDuration.WithLabelValues(name).Observe(time.Since(start).Seconds())
+		span.End()
+	}
+}
+
+// SQLiteStore is the persistent NewsStore backed by SQLite.
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+func NewSQLiteStore(dbPath string) (*SQLiteStore, error) {
+	db, err := initDB(dbPath)
+	if err != nil {
+		return nil, err
+	}
+	return &SQLiteStore{db: db}, nil
+}
+
+func initDB(dbPath string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		return nil, err
+	}
+	// A single connection keeps ":memory:" databases shared and
+	// serializes writers from the feed pollers.
+	db.SetMaxOpenConns(1)
+
+	if err := platform.Migrate(db, migrations); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+func (s *SQLiteStore) HasGUID(ctx context.Context, guidHash string) (bool, error) {
+	defer startQuery(ctx, "has_guid")()
+
+	var exists int
+	err := s.db.QueryRowContext(ctx, `
+		SELECT 1 FROM news WHERE guid_hash = ?
+		UNION ALL
+		SELECT 1 FROM news_sources WHERE guid_hash = ?
+		LIMIT 1`, guidHash, guidHash).Scan(&exists)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *SQLiteStore) FindDuplicate(ctx context.Context, candidate newsCandidate) (int, error) {
+	defer startQuery(ctx, "find_duplicate")()
+
+	var id int
+	if candidate.CanonicalLink != "" {
+		err := s.db.QueryRowContext(ctx, `
+			SELECT id FROM news WHERE canonical_link = ?
+			UNION ALL
+			SELECT news_id FROM news_sources WHERE canonical_link = ?
+			LIMIT 1`, candidate.CanonicalLink, candidate.CanonicalLink).Scan(&id)
+		if err == nil {
+			return id, nil
+		}
+		if err != sql.ErrNoRows {
+			return 0, err
+		}
+	}
+
+	from := candidate.PublishedAt.Add(-titleDuplicateWindow).UTC().Format(dateFormat)
+	to := candidate.PublishedAt.Add(titleDuplicateWindow).UTC().Format(dateFormat)
+	rows, err := s.db.QueryContext(ctx, "SELECT id, title FROM news WHERE published_at BETWEEN ? AND ? ORDER BY id DESC", from, to)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var title string
+		if err := rows.Scan(&id, &title); err != nil {
+			return 0, err
+		}
+		if similarTitles(title, candidate.Title) {
+			return id, nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	return 0, ErrNewsNotFound
+}
+
+func (s *SQLiteStore) InsertNews(ctx context.Context, candidate newsCandidate) (int, error) {
+	defer startQuery(ctx, "insert_news")()
+
+	result, err := s.db.ExecContext(ctx, `
+		INSERT OR IGNORE INTO news (guid, guid_hash, feed, category, source, title, content, link, canonical_link, published_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		candidate.GUID, candidate.GUIDHash, candidate.Feed, candidate.Category, candidate.Source, candidate.Title,
+		candidate.Content, candidate.Link, candidate.CanonicalLink, candidate.PublishedAt.UTC().Format(dateFormat))
+	if err != nil {
+		return 0, err
+	}
+	// Another poller may have stored the same story in the meantime.
+	if n, _ := result.RowsAffected(); n == 0 {
+		return 0, errNewsExists
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return int(id), nil
+}
+
+func (s *SQLiteStore) AddSource(ctx context.Context, newsID int, candidate newsCandidate) error {
+	defer startQuery(ctx, "add_source")()
+
+	var exists int
+	err := s.db.QueryRowContext(ctx, `
+		SELECT 1 FROM news WHERE id = ? AND feed = ? AND canonical_link = ?
+		UNION ALL
+		SELECT 1 FROM news_sources WHERE news_id = ? AND feed = ? AND canonical_link = ?
+		LIMIT 1`,
+		newsID, candidate.Feed, candidate.CanonicalLink,
+		newsID, candidate.Feed, candidate.CanonicalLink).Scan(&exists)
+	if err == nil {
+		return nil
+	}
+	if err != sql.ErrNoRows {
+		return err
+	}
+
+	_, err = s.db.ExecContext(ctx, `
+		INSERT OR IGNORE INTO news_sources (news_id, guid_hash, feed, link, canonical_link)
+		VALUES (?, ?, ?, ?, ?)`,
+		newsID, candidate.GUIDHash, candidate.Feed, candidate.Link, candidate.CanonicalLink)
+	return err
+}
+
+func (s *SQLiteStore) ListNews(ctx context.Context, listing NewsListing) ([]NewsItem, int, error) {
+	// Search matches are joined as a JSON array of IDs ranked by
+	// relevance, so that one parameter carries any number of them.
+	from := "news"
+	if listing.Matches != nil {
+		from = "json_each(?) AS match JOIN news ON news.id = match.value"
+	}
+
+	where := " WHERE 1 = 1"
+	var args []interface{}
+	filter := listing.Filter
+	if filter.Category != "" {
+		where += " AND news.category = ?"
+		args = append(args, filter.Category)
+	}
+	if filter.Source != "" {
+		where += " AND news.source = ?"
+		args = append(args, filter.Source)
+	}
+	if !filter.From.IsZero() {
+		where += " AND news.published_at >= ?"
+		args = append(args, filter.From.UTC().Format(dateFormat))
+	}
+	if !filter.To.IsZero() {
+		where += " AND news.published_at < ?"
+		args = append(args, filter.To.UTC().Format(dateFormat))
+	}
+
+	countArgs := args
+	if listing.Matches != nil {
+		countArgs = append([]interface{}{jsonIDs(listing.rankedMatches(false))}, args...)
+	}
+	var total int
+	done := startQuery(ctx, "count_news")
+	err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+from+where, countArgs...).Scan(&total)
+	done()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// Matches before a relevance cursor are left out of the array, a date
+	// cursor becomes a keyset predicate.
+	order := " ORDER BY news.published_at DESC, news.id DESC"
+	if listing.Sort == sortByRelevance && listing.Matches != nil {
+		order = " ORDER BY match.key"
+	} else if c := listing.After; c != nil {
+		published := time.Unix(0, c.Time).UTC().Format(dateFormat)
+		where += " AND (news.published_at < ? OR (news.published_at = ? AND news.id < ?))"
+		args = append(args, published, published, c.ID)
+	}
+	if listing.Matches != nil {
+		args = append([]interface{}{jsonIDs(listing.rankedMatches(true))}, args...)
+	}
+	limit := listing.Limit
+	if limit == 0 {
+		limit = -1
+	}
+	args = append(args, limit, listing.Offset)
+
+	done = startQuery(ctx, "list_news")
+	rows, err := s.db.QueryContext(ctx, "SELECT "+newsColumns+" FROM "+from+where+order+" LIMIT ? OFFSET ?", args...)
+	done()
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	news := []NewsItem{}
+	var ids []int
+	for rows.Next() {
+		item, err := scanNewsItem(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		news = append(news, item)
+		ids = append(ids, item.ID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	sources, err := s.alternateSources(ctx, ids)
+	if err != nil {
+		return nil, 0, err
+	}
+	for i := range news {
+		news[i].AlternateSources = sources[news[i].ID]
+	}
+	return news, total, nil
+}
+
+func (s *SQLiteStore) GetNews(ctx context.Context, id int) (*NewsItem, error) {
+	defer startQuery(ctx, "get_news")()
+
+	row := s.db.QueryRowContext(ctx, "SELECT "+newsColumns+" FROM news WHERE id = ?", id)
+	item, err := scanNewsItem(row)
+	if err == sql.ErrNoRows {
+		return nil, ErrNewsNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sources, err := s.alternateSources(ctx, []int{id})
+	if err != nil {
+		return nil, err
+	}
+	item.AlternateSources = sources[id]
+	return &item, nil
+}
+
+// alternateSources loads the alternate sources of the stories with the
+// given IDs, grouped by story ID.
+func (s *SQLiteStore) alternateSources(ctx context.Context, ids []int) (map[int][]AlternateSource, error) {
+	sources := make(map[int][]AlternateSource)
+	if len(ids) == 0 {
+		return sources, nil
+	}
+
+	defer startQuery(ctx, "list_sources")()
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT news_id, feed, link FROM news_sources
+		WHERE news_id IN (SELECT value FROM json_each(?))
+		ORDER BY id ASC`, jsonIDs(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		var source AlternateSource
+		if err := rows.Scan(&id, &source.Feed, &source.Link); err != nil {
+			return nil, err
+		}
+		sources[id] = append(sources[id], source)
+	}
+	return sources, rows.Err()
+}
+
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
+
+const newsColumns = "news.id, news.title, news.content, news.link, news.category, news.source, news.published_at"
+
+// jsonIDs encodes IDs as a JSON array for json_each.
+func jsonIDs(ids []int) string {
+	data, _ := json.Marshal(ids)
+	return string(data)
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanNewsItem(s scanner) (NewsItem, error) {
+	var item NewsItem
+	if err := s.Scan(&item.ID, &item.Title, &item.Content, &item.Link, &item.Category, &item.Source, &item.PublishedAt); err != nil {
+		return NewsItem{}, err
+	}
+	item.PublishedAt = item.PublishedAt.UTC()
+	return item, nil
+}
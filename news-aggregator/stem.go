@@ -0,0 +1,379 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+// stem reduces a lowercase word to its stem, choosing the Russian or the
+// English stemmer by the script of the word. Other words are returned
+// unchanged.
+func stem(word string) string {
+	for _, r := range word {
+		if unicode.Is(unicode.Cyrillic, r) {
+			return stemRussian(word)
+		}
+	}
+	for _, r := range word {
+		if r < 'a' || r > 'z' {
+			return word
+		}
+	}
+	return stemEnglish(word)
+}
+
+// Russian stemmer, following the Snowball algorithm:
+// https://snowballstem.org/algorithms/russian/stemmer.html
+
+type suffixGroup struct {
+	suffixes []string
+	// afterAYa requires the suffix to be preceded by "а" or "я".
+	afterAYa bool
+}
+
+var (
+	ruPerfectiveGerund = []suffixGroup{
+		{suffixes: []string{"в", "вши", "вшись"}, afterAYa: true},
+		{suffixes: []string{"ив", "ивши", "ившись", "ыв", "ывши", "ывшись"}},
+	}
+	ruAdjective = []suffixGroup{
+		{suffixes: []string{"ее", "ие", "ые", "ое", "ими", "ыми", "ей", "ий", "ый", "ой", "ем", "им", "ым", "ом",
+			"его", "ого", "ему", "ому", "их", "ых", "ую", "юю", "ая", "яя", "ою", "ею"}},
+	}
+	ruParticiple = []suffixGroup{
+		{suffixes: []string{"ем", "нн", "вш", "ющ", "щ"}, afterAYa: true},
+		{suffixes: []string{"ивш", "ывш", "ующ"}},
+	}
+	ruReflexive = []suffixGroup{
+		{suffixes: []string{"ся", "сь"}},
+	}
+	ruVerb = []suffixGroup{
+		{suffixes: []string{"ла", "на", "ете", "йте", "ли", "й", "л", "ем", "н", "ло", "но", "ет", "ют", "ны",
+			"ть", "ешь", "нно"}, afterAYa: true},
+		{suffixes: []string{"ила", "ыла", "ена", "ейте", "уйте", "ите", "или", "ыли", "ей", "уй", "ил", "ыл",
+			"им", "ым", "ен", "ило", "ыло", "ено", "ят", "ует", "уют", "ит", "ыт", "ены", "ить", "ыть", "ишь",
+			"ую", "ю"}},
+	}
+	ruNoun = []suffixGroup{
+		{suffixes: []string{"а", "ев", "ов", "ие", "ье", "е", "иями", "ями", "ами", "еи", "ии", "и", "ией",
+			"ей", "ой", "ий", "й", "иям", "ям", "ием", "ем", "ам", "ом", "о", "у", "ах", "иях", "ях", "ы", "ь",
+			"ию", "ью", "ю", "ия", "ья", "я"}},
+	}
+	ruSuperlative = []suffixGroup{
+		{suffixes: []string{"ейш", "ейше"}},
+	}
+	ruDerivational = []suffixGroup{
+		{suffixes: []string{"ост", "ость"}},
+	}
+)
+
+func isRussianVowel(r rune) bool {
+	return strings.ContainsRune("аеиоуыэюя", r)
+}
+
+func stemRussian(word string) string {
+	w := []rune(strings.ReplaceAll(word, "ё", "е"))
+
+	// RV is the region after the first vowel, R2 is R1 of R1 where R1 is
+	// the region after the first non-vowel following a vowel.
+	rv := len(w)
+	for i, r := range w {
+		if isRussianVowel(r) {
+			rv = i + 1
+			break
+		}
+	}
+	r1 := russianRegion(w, 0)
+	r2 := russianRegion(w, r1)
+
+	// Step 1
+	if cut, ok := matchSuffix(w, rv, ruPerfectiveGerund); ok {
+		w = w[:cut]
+	} else {
+		if cut, ok := matchSuffix(w, rv, ruReflexive); ok {
+			w = w[:cut]
+		}
+		if cut, ok := matchSuffix(w, rv, ruAdjective); ok {
+			w = w[:cut]
+			if cut, ok := matchSuffix(w, rv, ruParticiple); ok {
+				w = w[:cut]
+			}
+		} else if cut, ok := matchSuffix(w, rv, ruVerb); ok {
+			w = w[:cut]
+		} else if cut, ok := matchSuffix(w, rv, ruNoun); ok {
+			w = w[:cut]
+		}
+	}
+
+	// Step 2
+	if len(w) > rv && w[len(w)-1] == 'и' {
+		w = w[:len(w)-1]
+	}
+
+	// Step 3
+	if cut, ok := matchSuffix(w, r2, ruDerivational); ok {
+		w = w[:cut]
+	}
+
+	// Step 4
+	if cut, ok := matchSuffix(w, rv, ruSuperlative); ok {
+		w = w[:cut]
+	}
+	if hasSuffix(w, rv, "нн") {
+		w = w[:len(w)-1]
+	} else if hasSuffix(w, rv, "ь") {
+		w = w[:len(w)-1]
+	}
+
+	return string(w)
+}
+
+// russianRegion returns the start of the region after the first non-vowel
+// following a vowel, searching from start.
+func russianRegion(w []rune, start int) int {
+	for i := start + 1; i < len(w); i++ {
+		if !isRussianVowel(w[i]) && isRussianVowel(w[i-1]) {
+			return i + 1
+		}
+	}
+	return len(w)
+}
+
+// matchSuffix finds the longest suffix from groups lying entirely in the
+// region starting at start and returns the position it begins at.
+func matchSuffix(w []rune, start int, groups []suffixGroup) (int, bool) {
+	best, bestGroup := "", -1
+	for i, group := range groups {
+		for _, suffix := range group.suffixes {
+			if len([]rune(suffix)) > len([]rune(best)) && hasSuffix(w, start, suffix) {
+				best, bestGroup = suffix, i
+			}
+		}
+	}
+	if bestGroup < 0 {
+		return 0, false
+	}
+
+	cut := len(w) - len([]rune(best))
+	if groups[bestGroup].afterAYa {
+		if cut-1 < start || (w[cut-1] != 'а' && w[cut-1] != 'я') {
+			return 0, false
+		}
+	}
+	return cut, true
+}
+
+func hasSuffix(w []rune, start int, suffix string) bool {
+	s := []rune(suffix)
+	if len(w)-len(s) < start {
+		return false
+	}
+	return string(w[len(w)-len(s):]) == suffix
+}
+
+// English stemmer, following the original Porter algorithm:
+// https://tartarus.org/martin/PorterStemmer/def.txt
+
+func stemEnglish(word string) string {
+	if len(word) <= 2 {
+		return word
+	}
+	p := &porter{b: []byte(word)}
+	p.step1ab()
+	p.step1c()
+	p.step2()
+	p.step3()
+	p.step4()
+	p.step5()
+	return string(p.b)
+}
+
+type porter struct {
+	b []byte
+	// j marks the end of the stem while a suffix is being tested.
+	j int
+}
+
+func (p *porter) cons(i int) bool {
+	switch p.b[i] {
+	case 'a', 'e', 'i', 'o', 'u':
+		return false
+	case 'y':
+		return i == 0 || !p.cons(i-1)
+	}
+	return true
+}
+
+// m measures the number of consonant-vowel sequences in b[0:j].
+func (p *porter) m() int {
+	n, i := 0, 0
+	for ; i < p.j && p.cons(i); i++ {
+	}
+	for i < p.j {
+		for ; i < p.j && !p.cons(i); i++ {
+		}
+		if i >= p.j {
+			break
+		}
+		n++
+		for ; i < p.j && p.cons(i); i++ {
+		}
+	}
+	return n
+}
+
+func (p *porter) vowelInStem() bool {
+	for i := 0; i < p.j; i++ {
+		if !p.cons(i) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *porter) doublec(i int) bool {
+	return i >= 1 && p.b[i] == p.b[i-1] && p.cons(i)
+}
+
+// cvc reports whether b[i-2:i+1] is consonant-vowel-consonant with the
+// last consonant not w, x or y.
+func (p *porter) cvc(i int) bool {
+	if i < 2 || !p.cons(i) || p.cons(i-1) || !p.cons(i-2) {
+		return false
+	}
+	switch p.b[i] {
+	case 'w', 'x', 'y':
+		return false
+	}
+	return true
+}
+
+// ends reports whether b ends with s and sets j to the stem length.
+func (p *porter) ends(s string) bool {
+	if !strings.HasSuffix(string(p.b), s) {
+		return false
+	}
+	p.j = len(p.b) - len(s)
+	return true
+}
+
+func (p *porter) setTo(s string) {
+	p.b = append(p.b[:p.j], s...)
+}
+
+func (p *porter) replace(s string) {
+	if p.m() > 0 {
+		p.setTo(s)
+	}
+}
+
+func (p *porter) step1ab() {
+	if p.b[len(p.b)-1] == 's' {
+		switch {
+		case p.ends("sses"):
+			p.b = p.b[:len(p.b)-2]
+		case p.ends("ies"):
+			p.setTo("i")
+		case len(p.b) > 1 && p.b[len(p.b)-2] != 's':
+			p.b = p.b[:len(p.b)-1]
+		}
+	}
+
+	if p.ends("eed") {
+		if p.m() > 0 {
+			p.b = p.b[:len(p.b)-1]
+		}
+		return
+	}
+	if (p.ends("ed") || p.ends("ing")) && p.vowelInStem() {
+		p.b = p.b[:p.j]
+		switch {
+		case p.ends("at"):
+			p.setTo("ate")
+		case p.ends("bl"):
+			p.setTo("ble")
+		case p.ends("iz"):
+			p.setTo("ize")
+		case p.doublec(len(p.b) - 1):
+			switch p.b[len(p.b)-1] {
+			case 'l', 's', 'z':
+			default:
+				p.b = p.b[:len(p.b)-1]
+			}
+		default:
+			p.j = len(p.b)
+			if p.m() == 1 && p.cvc(len(p.b)-1) {
+				p.b = append(p.b, 'e')
+			}
+		}
+	}
+}
+
+func (p *porter) step1c() {
+	if p.ends("y") && p.vowelInStem() {
+		p.b[len(p.b)-1] = 'i'
+	}
+}
+
+var porterStep2 = [][2]string{
+	{"ational", "ate"}, {"tional", "tion"}, {"enci", "ence"}, {"anci", "ance"}, {"izer", "ize"},
+	{"bli", "ble"}, {"alli", "al"}, {"entli", "ent"}, {"eli", "e"}, {"ousli", "ous"},
+	{"ization", "ize"}, {"ation", "ate"}, {"ator", "ate"}, {"alism", "al"}, {"iveness", "ive"},
+	{"fulness", "ful"}, {"ousness", "ous"}, {"aliti", "al"}, {"iviti", "ive"}, {"biliti", "ble"},
+	{"logi", "log"},
+}
+
+var porterStep3 = [][2]string{
+	{"icate", "ic"}, {"ative", ""}, {"alize", "al"}, {"iciti", "ic"}, {"ical", "ic"}, {"ful", ""}, {"ness", ""},
+}
+
+func (p *porter) replaceFirst(rules [][2]string) {
+	for _, rule := range rules {
+		if p.ends(rule[0]) {
+			p.replace(rule[1])
+			return
+		}
+	}
+}
+
+func (p *porter) step2() {
+	p.replaceFirst(porterStep2)
+}
+
+func (p *porter) step3() {
+	p.replaceFirst(porterStep3)
+}
+
+var porterStep4 = []string{
+	"al", "ance", "ence", "er", "ic", "able", "ible", "ant", "ement", "ment", "ent",
+	"ion", "ou", "ism", "ate", "iti", "ous", "ive", "ize",
+}
+
+func (p *porter) step4() {
+	for _, suffix := range porterStep4 {
+		if !p.ends(suffix) {
+			continue
+		}
+		if suffix == "ion" && (p.j == 0 || (p.b[p.j-1] != 's' && p.b[p.j-1] != 't')) {
+			return
+		}
+		if p.m() > 1 {
+			p.b = p.b[:p.j]
+		}
+		return
+	}
+}
+
+func (p *porter) step5() {
+	p.j = len(p.b)
+	if p.b[len(p.b)-1] == 'e' {
+		p.j = len(p.b) - 1
+		if m := p.m(); m > 1 || (m == 1 && !p.cvc(len(p.b)-2)) {
+			p.b = p.b[:len(p.b)-1]
+		}
+	}
+	p.j = len(p.b)
+	if p.b[len(p.b)-1] == 'l' && p.doublec(len(p.b)-1) && p.m() > 1 {
+		p.b = p.b[:len(p.b)-1]
+	}
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// NewsStore persists aggregated news items.
+type NewsStore interface {
+	// HasGUID reports whether an item with this GUID hash was already
+	// stored, either as a story or as an alternate source.
+	HasGUID(ctx context.Context, guidHash string) (bool, error)
+	// FindDuplicate returns the ID of the story the candidate duplicates
+	// by canonical link or near-duplicate title, or ErrNewsNotFound.
+	FindDuplicate(ctx context.Context, candidate newsCandidate) (int, error)
+	// InsertNews stores the candidate as a new story and returns its ID.
+	InsertNews(ctx context.Context, candidate newsCandidate) (int, error)
+	// AddSource records the candidate as an alternate source of a story.
+	// A source from the same feed with the same canonical link as an
+	// already known one is ignored.
+	AddSource(ctx context.Context, newsID int, candidate newsCandidate) error
+	// ListNews returns the requested page of stored news and the number
+	// of all news matching the listing.
+	ListNews(ctx context.Context, listing NewsListing) ([]NewsItem, int, error)
+	// GetNews returns a single item or ErrNewsNotFound.
+	GetNews(ctx context.Context, id int) (*NewsItem, error)
+	Close() error
+}
+
+// NewsFilter narrows a news listing. Zero fields do not filter.
+type NewsFilter struct {
+	Category string
+	Source   string
+	// From and To bound the publication time, To is exclusive.
+	From time.Time
+	To   time.Time
+}
+
+// Match reports whether an item passes the filter.
+func (f NewsFilter) Match(item NewsItem) bool {
+	if f.Category != "" && item.Category != f.Category {
+		return false
+	}
+	if f.Source != "" && item.Source != f.Source {
+		return false
+	}
+	if !f.From.IsZero() && item.PublishedAt.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && !item.PublishedAt.Before(f.To) {
+		return false
+	}
+	return true
+}
+
+// NewsListing selects a page of news. News is ordered newest first, or
+// by relevance when Sort is sortByRelevance.
+type NewsListing struct {
+	Filter NewsFilter
+	// Matches restricts the listing to search results when not nil.
+	Matches []SearchResult
+	Sort    string
+	// After continues the listing after a cursor, Offset skips items
+	// from its start. Limit 0 returns every remaining item.
+	After  *newsCursor
+	Offset int
+	Limit  int
+}
+
+// rankedMatches returns the IDs of the matches ordered by relevance.
+// When onlyAfter is set, the ones before a relevance cursor are left out;
+// a date cursor does not depend on the score and is left to the caller.
+func (l NewsListing) rankedMatches(onlyAfter bool) []int {
+	onlyAfter = onlyAfter && l.After != nil && l.Sort == sortByRelevance
+
+	matches := append([]SearchResult(nil), l.Matches...)
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].Score != matches[j].Score {
+			return matches[i].Score > matches[j].Score
+		}
+		return matches[i].ID > matches[j].ID
+	})
+
+	ids := make([]int, 0, len(matches))
+	for _, match := range matches {
+		if onlyAfter && !l.After.after(NewsItem{ID: match.ID}, match.Score) {
+			continue
+		}
+		ids = append(ids, match.ID)
+	}
+	return ids
+}
+
+// page applies the listing to news sorted newest first, for stores that
+// hold every item in memory.
+func (l NewsListing) page(news []NewsItem) ([]NewsItem, int) {
+	var scores map[int]float64
+	if l.Matches != nil {
+		scores = make(map[int]float64, len(l.Matches))
+		for _, match := range l.Matches {
+			scores[match.ID] = match.Score
+		}
+		filtered := []NewsItem{}
+		for _, item := range news {
+			if _, ok := scores[item.ID]; ok {
+				filtered = append(filtered, item)
+			}
+		}
+		if l.Sort == sortByRelevance {
+			sort.SliceStable(filtered, func(i, j int) bool {
+				a, b := filtered[i], filtered[j]
+				if scores[a.ID] != scores[b.ID] {
+					return scores[a.ID] > scores[b.ID]
+				}
+				return a.ID > b.ID
+			})
+		}
+		news = filtered
+	}
+
+	start := l.Offset
+	if l.After != nil {
+		start = len(news)
+		for i, item := range news {
+			if l.After.after(item, scores[item.ID]) {
+				start = i
+				break
+			}
+		}
+	}
+	if start < 0 {
+		start = 0
+	}
+	if start > len(news) {
+		start = len(news)
+	}
+	end := len(news)
+	if l.Limit > 0 && l.Limit < end-start {
+		end = start + l.Limit
+	}
+	return news[start:end], len(news)
+}
+
+// validCategories are the categories news can be filtered by.
+var validCategories = map[string]bool{
+	"tech":      true,
+	"economics": true,
+	"politics":  true,
+	"sports":    true,
+	"culture":   true,
+}
+
+var ErrNewsNotFound = errors.New("news not found")
+
+// errNewsExists is returned by InsertNews when a concurrent writer has
+// already stored a story with the same GUID or link.
+var errNewsExists = errors.New("news already exists")
+
+const dateFormat = "2006-01-02 15:04:05"
+
+// newStore creates the store selected by NEWS_STORE.
+func newStore(config Config) (NewsStore, error) {
+	switch config.Store {
+	case "sqlite":
+		return NewSQLiteStore(config.DBPath)
+	case "memory":
+		return NewMemoryStore(), nil
+	default:
+		return nil, fmt.Errorf("unknown store %q", config.Store)
+	}
+}
+
+// newsQuery holds the listing parameters accepted by GET /news.
+type newsQuery struct {
+	Page     int
+	PageSize int
+	// After continues the listing after a cursor instead of using Page.
+	After  *newsCursor
+	Filter NewsFilter
+	Search string
+	Sort   string
+}
+
+// newsPage is one page of a news listing. Total counts every item
+// matching the query, not only the ones on the page.
+type newsPage struct {
+	Items      []NewsItem
+	Total      int
+	NextCursor string
+}
+
+const (
+	sortByDate      = "date"
+	sortByRelevance = "relevance"
+)
+
+// queryNews returns the requested page of news. News is ordered newest
+// first unless a search is sorted by relevance.
+func queryNews(ctx context.Context, store NewsStore, index *SearchIndex, q newsQuery) (newsPage, error) {
+	listing := NewsListing{
+		Filter: q.Filter,
+		Sort:   q.Sort,
+		After:  q.After,
+		// One more item than requested tells whether there is a next page.
+		Limit: q.PageSize + 1,
+	}
+	if q.After == nil {
+		listing.Offset = (q.Page - 1) * q.PageSize
+	}
+
+	var scores map[int]float64
+	if q.Search != "" {
+		listing.Matches = index.Search(q.Search)
+		scores = make(map[int]float64, len(listing.Matches))
+		for _, match := range listing.Matches {
+			scores[match.ID] = match.Score
+		}
+	}
+
+	news, total, err := store.ListNews(ctx, listing)
+	if err != nil {
+		return newsPage{}, err
+	}
+
+	page := newsPage{Items: news, Total: total}
+	if len(news) > q.PageSize {
+		page.Items = news[:q.PageSize]
+		last := page.Items[q.PageSize-1]
+		page.NextCursor = newsCursor{Sort: q.Sort, Time: last.PublishedAt.UnixNano(), Score: scores[last.ID], ID: last.ID}.encode()
+	}
+	return page, nil
+}
+
+// validFeedItem reports whether an item has enough data to be stored.
+func validFeedItem(item FeedItem) bool {
+	return item.GUID != "" && item.Title != ""
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func storeImplementations(t *testing.T) map[string]NewsStore {
+	t.Helper()
+
+	sqliteStore, err := NewSQLiteStore(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	t.Cleanup(func() { sqliteStore.Close() })
+
+	return map[string]NewsStore{
+		"sqlite": sqliteStore,
+		"memory": NewMemoryStore(),
+	}
+}
+
+func TestNewsStoreDeduplicates(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Second)
+
+	for name, store := range storeImplementations(t) {
+		t.Run(name, func(t *testing.T) {
+			items := []FeedItem{
+				{GUID: "a", Title: "First", Link: "https://example.com/a", PublishedAt: now.Add(-time.Hour)},
+				{GUID: "b", Title: "Second", Link: "https://example.com/b", PublishedAt: now},
+				{GUID: "", Title: "Without GUID", Link: "https://example.com/c", PublishedAt: now},
+			}
+			inserted, err := saveItems(ctx, store, items)
+			if err != nil {
+				t.Fatalf("saveItems returned error: %v", err)
+			}
+			if inserted != 2 {
+				t.Errorf("expected 2 inserted items, got %d", inserted)
+			}
+
+			// Same GUID, and a new GUID pointing at a known link.
+			duplicates := []FeedItem{
+				{GUID: "a", Title: "First again", Link: "https://example.com/a2", PublishedAt: now},
+				{GUID: "b-renamed", Title: "Second again", Link: "https://example.com/b", PublishedAt: now},
+			}
+			inserted, err = saveItems(ctx, store, duplicates)
+			if err != nil {
+				t.Fatalf("saveItems returned error: %v", err)
+			}
+			if inserted != 0 {
+				t.Errorf("expected duplicates to be skipped, got %d inserted", inserted)
+			}
+
+			news, _, err := store.ListNews(ctx, NewsListing{})
+			if err != nil {
+				t.Fatalf("ListNews returned error: %v", err)
+			}
+			if len(news) != 2 {
+				t.Fatalf("expected 2 stored items, got %d", len(news))
+			}
+			if news[0].Title != "Second" {
+				t.Errorf("expected newest item first, got %q", news[0].Title)
+			}
+
+			item, err := store.GetNews(ctx, news[1].ID)
+			if err != nil {
+				t.Fatalf("GetNews returned error: %v", err)
+			}
+			if item.Title != "First" {
+				t.Errorf("unexpected item: %+v", item)
+			}
+
+			if _, err := store.GetNews(ctx, 1000); err != ErrNewsNotFound {
+				t.Errorf("expected ErrNewsNotFound, got %v", err)
+			}
+		})
+	}
+}
+
+func TestInsertNewsRejectsExisting(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Second)
+
+	for name, store := range storeImplementations(t) {
+		t.Run(name, func(t *testing.T) {
+			first := newCandidate(FeedItem{GUID: "a", Title: "First", Link: "https://example.com/a", PublishedAt: now})
+			if _, err := store.InsertNews(ctx, first); err != nil {
+				t.Fatalf("InsertNews returned error: %v", err)
+			}
+
+			// What a concurrent poller would insert after both passed the
+			// duplicate checks.
+			for _, item := range []FeedItem{
+				{GUID: "a", Title: "Same GUID", Link: "https://example.com/other", PublishedAt: now},
+				{GUID: "b", Title: "Same link", Link: "https://example.com/a", PublishedAt: now},
+			} {
+				if _, err := store.InsertNews(ctx, newCandidate(item)); err != errNewsExists {
+					t.Errorf("%s: expected errNewsExists, got %v", item.Title, err)
+				}
+			}
+
+			news, _, err := store.ListNews(ctx, NewsListing{})
+			if err != nil {
+				t.Fatalf("ListNews returned error: %v", err)
+			}
+			if len(news) != 1 {
+				t.Errorf("expected 1 stored item, got %d", len(news))
+			}
+		})
+	}
+}
+
+func TestMigrationsPersistAcrossRestarts(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "news.db")
+
+	store, err := NewSQLiteStore(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	items := []FeedItem{{GUID: "a", Title: "First", Link: "https://example.com/a", PublishedAt: time.Now()}}
+	if _, err := saveItems(context.Background(), store, items); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	// Reopening must not re-run migrations or lose data.
+	store, err = NewSQLiteStore(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to reopen database: %v", err)
+	}
+	defer store.Close()
+
+	var version, applied int
+	err = store.db.QueryRow("SELECT MAX(version), COUNT(*) FROM schema_migrations").Scan(&version, &applied)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != len(migrations) || applied != len(migrations) {
+		t.Errorf("expected %d applied migrations, got version %d with %d rows", len(migrations), version, applied)
+	}
+
+	item, err := store.GetNews(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("GetNews returned error: %v", err)
+	}
+	if item.Title != "First" {
+		t.Errorf("unexpected item after restart: %+v", item)
+	}
+}
@@ -0,0 +1,47 @@
+package platform
+
+import (
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
+)
+
+// GetEnv returns the environment variable key or defaultValue when it is
+// unset or empty.
+func GetEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+// GetDurationEnv reads a duration such as "5s" from the environment. An
+// invalid value is logged and replaced by defaultValue.
+func GetDurationEnv(key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		slog.Warn("Invalid duration in environment, using default", "key", key, "value", value, "default", defaultValue.String())
+		return defaultValue
+	}
+	return d
+}
+
+// GetIntEnv reads an integer from the environment. An invalid value is
+// logged and replaced by defaultValue.
+func GetIntEnv(key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		slog.Warn("Invalid integer in environment, using default", "key", key, "value", value, "default", defaultValue)
+		return defaultValue
+	}
+	return n
+}
@@ -0,0 +1,162 @@
+package platform
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// checkTimeout bounds a single readiness check.
+const checkTimeout = 2 * time.Second
+
+// CheckFunc reports whether a dependency is usable.
+type CheckFunc func(ctx context.Context) error
+
+// HealthCheck is a dependency probed by the readiness endpoint.
+type HealthCheck struct {
+	Name  string
+	Check CheckFunc
+	// Optional checks are reported but a failure only degrades the
+	// service instead of making it not ready.
+	Optional bool
+	// Details, if set, adds extra state to the result.
+	Details func() interface{}
+}
+
+// CheckResult is the outcome of a HealthCheck.
+type CheckResult struct {
+	Name      string      `json:"name"`
+	Status    string      `json:"status"`
+	Optional  bool        `json:"optional,omitempty"`
+	LatencyMS float64     `json:"latency_ms"`
+	Error     string      `json:"error,omitempty"`
+	Details   interface{} `json:"details,omitempty"`
+}
+
+// Health statuses.
+const (
+	StatusOK           = "ok"
+	StatusFail         = "fail"
+	StatusDegraded     = "degraded"
+	StatusUnavailable  = "unavailable"
+	StatusShuttingDown = "shutting_down"
+)
+
+// HealthHandler reports that the process is up. It is used for liveness
+// and never checks dependencies.
+func HealthHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(Response{Status: StatusOK})
+}
+
+// AddHealthCheck registers a dependency check for /health/ready.
+func (s *Server) AddHealthCheck(check HealthCheck) {
+	s.checks = append(s.checks, check)
+}
+
+// readyHandler runs every health check concurrently. The service is ready
+// when all required checks pass; failing optional checks report it as
+// degraded.
+func (s *Server) readyHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.Ready() {
+		WriteJSON(w, http.StatusServiceUnavailable, Response{Status: StatusShuttingDown})
+		return
+	}
+
+	results := runChecks(r.Context(), s.checks)
+
+	status, code := StatusOK, http.StatusOK
+	for _, result := range results {
+		if result.Status == StatusOK {
+			continue
+		}
+		if !result.Optional {
+			status, code = StatusUnavailable, http.StatusServiceUnavailable
+			break
+		}
+		status = StatusDegraded
+	}
+
+	WriteJSON(w, code, Response{
+		Status: status,
+		Data:   map[string][]CheckResult{"checks": results},
+	})
+}
+
+func runChecks(ctx context.Context, checks []HealthCheck) []CheckResult {
+	results := make([]CheckResult, len(checks))
+
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func(i int, check HealthCheck) {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+			defer cancel()
+
+			start := time.Now()
+			err := check.Check(ctx)
+			result := CheckResult{
+				Name:      check.Name,
+				Status:    StatusOK,
+				Optional:  check.Optional,
+				LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+			}
+			if err != nil {
+				result.Status = StatusFail
+				result.Error = err.Error()
+			}
+			if check.Details != nil {
+				result.Details = check.Details()
+			}
+			results[i] = result
+		}(i, check)
+	}
+	wg.Wait()
+
+	return results
+}
+
+// CachedCheck reuses the result of check for ttl, so frequent readiness
+// probes do not hammer the dependency.
+func CachedCheck(check CheckFunc, ttl time.Duration) CheckFunc {
+	var (
+		mutex   sync.Mutex
+		checked time.Time
+		lastErr error
+	)
+	return func(ctx context.Context) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		if !checked.IsZero() && time.Since(checked) < ttl {
+			return lastErr
+		}
+		lastErr = check(ctx)
+		checked = time.Now()
+		return lastErr
+	}
+}
+
+// HTTPCheck probes url and expects a 2xx answer.
+func HTTPCheck(client *http.Client, url string) CheckFunc {
+	return func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return fmt.Errorf("%s returned status %d", url, resp.StatusCode)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,133 @@
+package platform
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type readyResponse struct {
+	Status string `json:"status"`
+	Data   struct {
+		Checks []CheckResult `json:"checks"`
+	} `json:"data"`
+}
+
+func getReady(t *testing.T, server *Server) (int, readyResponse) {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	server.Router.ServeHTTP(rr, httptest.NewRequest("GET", "/health/ready", nil))
+
+	var response readyResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("could not unmarshal response: %v", err)
+	}
+	return rr.Code, response
+}
+
+func TestReadyHandlerChecks(t *testing.T) {
+	ok := func(ctx context.Context) error { return nil }
+	fail := func(ctx context.Context) error { return errors.New("connection refused") }
+
+	tests := []struct {
+		name   string
+		checks []HealthCheck
+		code   int
+		status string
+	}{
+		{"no checks", nil, http.StatusOK, StatusOK},
+		{"all pass", []HealthCheck{{Name: "db", Check: ok}, {Name: "cache", Check: ok, Optional: true}}, http.StatusOK, StatusOK},
+		{"optional fails", []HealthCheck{{Name: "db", Check: ok}, {Name: "cache", Check: fail, Optional: true}}, http.StatusOK, StatusDegraded},
+		{"required fails", []HealthCheck{{Name: "db", Check: fail}, {Name: "cache", Check: ok, Optional: true}}, http.StatusServiceUnavailable, StatusUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := NewServer("Test Service", "0")
+			server.ready.Store(true)
+			for _, check := range tt.checks {
+				server.AddHealthCheck(check)
+			}
+
+			code, response := getReady(t, server)
+			if code != tt.code || response.Status != tt.status {
+				t.Errorf("got %d %q, want %d %q", code, response.Status, tt.code, tt.status)
+			}
+			if len(response.Data.Checks) != len(tt.checks) {
+				t.Fatalf("expected %d check results, got %+v", len(tt.checks), response.Data.Checks)
+			}
+			for i, result := range response.Data.Checks {
+				if result.Name != tt.checks[i].Name {
+					t.Errorf("check %d: got name %q want %q", i, result.Name, tt.checks[i].Name)
+				}
+				if (result.Status == StatusFail) != (result.Error != "") {
+					t.Errorf("check %d: inconsistent result %+v", i, result)
+				}
+			}
+		})
+	}
+}
+
+func TestReadyHandlerNotServing(t *testing.T) {
+	server := NewServer("Test Service", "0")
+	if code, response := getReady(t, server); code != http.StatusServiceUnavailable || response.Status != StatusShuttingDown {
+		t.Errorf("got %d %q before serving", code, response.Status)
+	}
+}
+
+func TestReadyHandlerDetails(t *testing.T) {
+	server := NewServer("Test Service", "0")
+	server.ready.Store(true)
+	server.AddHealthCheck(HealthCheck{
+		Name:    "upstream",
+		Check:   func(ctx context.Context) error { return nil },
+		Details: func() interface{} { return map[string]string{"state": "closed"} },
+	})
+
+	_, response := getReady(t, server)
+	details, ok := response.Data.Checks[0].Details.(map[string]interface{})
+	if !ok || details["state"] != "closed" {
+		t.Errorf("unexpected details: %+v", response.Data.Checks[0])
+	}
+}
+
+func TestCachedCheck(t *testing.T) {
+	calls := 0
+	check := CachedCheck(func(ctx context.Context) error {
+		calls++
+		return nil
+	}, 50*time.Millisecond)
+
+	check(context.Background())
+	check(context.Background())
+	if calls != 1 {
+		t.Errorf("expected a cached result, check ran %d times", calls)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	check(context.Background())
+	if calls != 2 {
+		t.Errorf("expected the check to run again after ttl, ran %d times", calls)
+	}
+}
+
+func TestHTTPCheck(t *testing.T) {
+	up := httptest.NewServer(http.HandlerFunc(HealthHandler))
+	defer up.Close()
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+
+	client := &http.Client{}
+	if err := HTTPCheck(client, up.URL)(context.Background()); err != nil {
+		t.Errorf("expected healthy upstream, got %v", err)
+	}
+	if err := HTTPCheck(client, failing.URL)(context.Background()); err == nil {
+		t.Error("expected an error for a 503 answer")
+	}
+}
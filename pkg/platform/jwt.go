@@ -0,0 +1,358 @@
+package platform
+
+import (
+	"bytes"
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// JWT signing algorithms.
+const (
+	HS256 = "HS256"
+	RS256 = "RS256"
+)
+
+var (
+	// ErrInvalidToken is returned for malformed tokens and bad signatures.
+	ErrInvalidToken = errors.New("invalid token")
+	// ErrTokenExpired is returned for tokens past their exp claim.
+	ErrTokenExpired = errors.New("token expired")
+	// ErrUnknownKey is returned when no key matches the kid of a token.
+	ErrUnknownKey = errors.New("unknown signing key")
+)
+
+// Audience is the aud claim, a single string or an array in JSON.
+type Audience = jwt.ClaimStrings
+
+// Claims are the registered JWT claims plus the user fields used by the
+// services.
+type Claims struct {
+	Subject   string   `json:"sub"`
+	Name      string   `json:"name,omitempty"`
+	Role      string   `json:"role,omitempty"`
+	Issuer    string   `json:"iss,omitempty"`
+	Audience  Audience `json:"aud,omitempty"`
+	ExpiresAt int64    `json:"exp,omitempty"`
+	NotBefore int64    `json:"nbf,omitempty"`
+	IssuedAt  int64    `json:"iat,omitempty"`
+	ID        string   `json:"jti,omitempty"`
+}
+
+// The jwt.Claims methods let the parser validate the registered claims.
+
+func (c *Claims) GetExpirationTime() (*jwt.NumericDate, error) { return numericDate(c.ExpiresAt), nil }
+func (c *Claims) GetNotBefore() (*jwt.NumericDate, error)      { return numericDate(c.NotBefore), nil }
+func (c *Claims) GetIssuedAt() (*jwt.NumericDate, error)       { return numericDate(c.IssuedAt), nil }
+func (c *Claims) GetIssuer() (string, error)                   { return c.Issuer, nil }
+func (c *Claims) GetSubject() (string, error)                  { return c.Subject, nil }
+func (c *Claims) GetAudience() (jwt.ClaimStrings, error)       { return c.Audience, nil }
+
+// Validate rejects tokens without a subject, which the services use as the
+// user ID.
+func (c *Claims) Validate() error {
+	if c.Subject == "" {
+		return errors.New("missing subject")
+	}
+	return nil
+}
+
+func numericDate(unix int64) *jwt.NumericDate {
+	if unix == 0 {
+		return nil
+	}
+	return jwt.NewNumericDate(time.Unix(unix, 0))
+}
+
+// KeySource looks up the RSA public key that signed a token by key ID.
+type KeySource interface {
+	Key(ctx context.Context, kid string) (*rsa.PublicKey, error)
+}
+
+// JWTVerifier checks the signature and time claims of JWTs. Only the
+// algorithms it has keys for are accepted, so an HS256 token can never be
+// checked against an RSA public key.
+type JWTVerifier struct {
+	// HMACSecret verifies HS256 tokens when set.
+	HMACSecret []byte
+	// Keys verifies RS256 tokens when set.
+	Keys KeySource
+	// Issuer and Audience, when set, must match the iss and aud claims.
+	Issuer   string
+	Audience string
+	// Leeway tolerates clock skew when checking exp and nbf.
+	Leeway time.Duration
+
+	now func() time.Time
+}
+
+// Verify parses token and returns its claims if the signature and claims
+// are valid. Errors wrap ErrInvalidToken, ErrTokenExpired or ErrUnknownKey.
+func (v *JWTVerifier) Verify(ctx context.Context, token string) (*Claims, error) {
+	var claims Claims
+	_, err := v.parser().ParseWithClaims(token, &claims, func(token *jwt.Token) (interface{}, error) {
+		switch token.Method.Alg() {
+		case HS256:
+			return v.HMACSecret, nil
+		case RS256:
+			kid, _ := token.Header["kid"].(string)
+			return v.Keys.Key(ctx, kid)
+		}
+		return nil, fmt.Errorf("unsupported algorithm %q", token.Method.Alg())
+	})
+	switch {
+	case errors.Is(err, jwt.ErrTokenExpired):
+		return nil, ErrTokenExpired
+	case err != nil:
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+	return &claims, nil
+}
+
+// parser returns a parser accepting only the algorithms v has keys for.
+func (v *JWTVerifier) parser() *jwt.Parser {
+	var methods []string
+	if len(v.HMACSecret) > 0 {
+		methods = append(methods, HS256)
+	}
+	if v.Keys != nil {
+		methods = append(methods, RS256)
+	}
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods(methods),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(v.Leeway),
+	}
+	if v.Issuer != "" {
+		options = append(options, jwt.WithIssuer(v.Issuer))
+	}
+	if v.Audience != "" {
+		options = append(options, jwt.WithAudience(v.Audience))
+	}
+	if v.now != nil {
+		options = append(options, jwt.WithTimeFunc(v.now))
+	}
+	return jwt.NewParser(options...)
+}
+
+// SignHS256 returns claims as a JWT signed with secret.
+func SignHS256(claims Claims, secret []byte) (string, error) {
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, &claims).SignedString(secret)
+}
+
+// SignRS256 returns claims as a JWT signed with key, tagged with kid so
+// verifiers can pick the public key from a JWKS.
+func SignRS256(claims Claims, key *rsa.PrivateKey, kid string) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, &claims)
+	token.Header["kid"] = kid
+	return token.SignedString(key)
+}
+
+// jwk is an RSA key of a JSON Web Key Set.
+type jwk struct {
+	KeyType string `json:"kty"`
+	KeyID   string `json:"kid"`
+	Use     string `json:"use,omitempty"`
+	Alg     string `json:"alg,omitempty"`
+	N       string `json:"n"`
+	E       string `json:"e"`
+}
+
+// ParseJWKS returns the RSA signing keys of a JSON Web Key Set by key ID.
+// Keys of other types or uses are skipped.
+func ParseJWKS(data []byte) (map[string]*rsa.PublicKey, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+	for _, k := range set.Keys {
+		if k.KeyType != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: modulus: %w", k.KeyID, err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: exponent: %w", k.KeyID, err)
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("key %q: invalid exponent", k.KeyID)
+		}
+		keys[k.KeyID] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}
+	}
+	return keys, nil
+}
+
+// EncodeJWKS returns a JSON Web Key Set holding the public keys by key ID.
+func EncodeJWKS(keys map[string]*rsa.PublicKey) ([]byte, error) {
+	set := struct {
+		Keys []jwk `json:"keys"`
+	}{Keys: []jwk{}}
+	for kid, key := range keys {
+		set.Keys = append(set.Keys, jwk{
+			KeyType: "RSA",
+			KeyID:   kid,
+			Use:     "sig",
+			Alg:     RS256,
+			N:       base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:       base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		})
+	}
+	return json.Marshal(set)
+}
+
+// jwksRefreshInterval limits how often an unknown key ID triggers a fetch
+// of a remote JWKS.
+const jwksRefreshInterval = 30 * time.Second
+
+// JWKS is a KeySource backed by a JSON Web Key Set read from a file or
+// fetched from a URL.
+type JWKS struct {
+	url    string
+	ttl    time.Duration
+	client *http.Client
+
+	mutex   sync.Mutex
+	keys    map[string]*rsa.PublicKey
+	fetched time.Time
+	// refreshing is closed when the fetch in flight completes, and nil
+	// when none is.
+	refreshing chan struct{}
+	fetchErr   error
+}
+
+// LoadJWKSFile reads a key set from path once.
+func LoadJWKSFile(path string) (*JWKS, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := ParseJWKS(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &JWKS{keys: keys}, nil
+}
+
+// NewRemoteJWKS returns a key set fetched from url on first use and again
+// after ttl, or earlier when a token names an unknown key ID, so keys can
+// be rotated.
+func NewRemoteJWKS(url string, ttl time.Duration) *JWKS {
+	return &JWKS{
+		url:    url,
+		ttl:    ttl,
+		client: &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+// Key returns the key with ID kid. An empty kid matches the only key of a
+// set holding a single one.
+func (j *JWKS) Key(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	if j.url != "" {
+		if err := j.refresh(ctx, kid); err != nil {
+			return nil, fmt.Errorf("fetch JWKS: %w", err)
+		}
+	}
+
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	if key, ok := j.keys[kid]; ok {
+		return key, nil
+	}
+	if kid == "" && len(j.keys) == 1 {
+		for _, key := range j.keys {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("%w %q", ErrUnknownKey, kid)
+}
+
+// refresh fetches the key set when it is missing, older than the TTL or
+// lacks kid. Concurrent callers share one fetch, made without holding
+// j.mutex so lookups of known keys do not wait for it, while lookups of
+// unknown ones wait for its result. An error is returned only when no keys
+// are available.
+func (j *JWKS) refresh(ctx context.Context, kid string) error {
+	j.mutex.Lock()
+	age := time.Since(j.fetched)
+	_, known := j.keys[kid]
+	if known && (age < j.ttl || j.refreshing != nil) ||
+		!known && j.keys != nil && j.refreshing == nil && age < jwksRefreshInterval {
+		j.mutex.Unlock()
+		return nil
+	}
+
+	if done := j.refreshing; done != nil {
+		j.mutex.Unlock()
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	} else {
+		done = make(chan struct{})
+		j.refreshing = done
+		// Failed fetches are not retried before the refresh interval either.
+		j.fetched = time.Now()
+		j.mutex.Unlock()
+
+		// Other callers wait for this fetch, so it outlives ctx.
+		keys, err := j.fetch(context.WithoutCancel(ctx))
+
+		j.mutex.Lock()
+		if err == nil {
+			j.keys = keys
+		}
+		j.fetchErr = err
+		j.refreshing = nil
+		j.mutex.Unlock()
+		close(done)
+	}
+
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	if j.keys == nil {
+		return j.fetchErr
+	}
+	return nil
+}
+
+// fetch returns the key set at j.url.
+func (j *JWKS) fetch(ctx context.Context) (map[string]*rsa.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, j.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := j.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned status %d", j.url, resp.StatusCode)
+	}
+
+	var buf bytes.Buffer
+	if _, err := io.Copy(&buf, io.LimitReader(resp.Body, 1<<20)); err != nil {
+		return nil, err
+	}
+	return ParseJWKS(buf.Bytes())
+}
@@ -0,0 +1,287 @@
+package platform
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func validClaims() Claims {
+	return Claims{
+		Subject:   "user-1",
+		Name:      "Анна",
+		Issuer:    "auth-service",
+		Audience:  Audience{"news"},
+		ExpiresAt: time.Now().Add(time.Hour).Unix(),
+	}
+}
+
+func TestJWTVerifierHS256(t *testing.T) {
+	secret := []byte("secret")
+	verifier := &JWTVerifier{HMACSecret: secret, Issuer: "auth-service", Audience: "news"}
+
+	token, err := SignHS256(validClaims(), secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := verifier.Verify(context.Background(), token)
+	if err != nil {
+		t.Fatalf("valid token rejected: %v", err)
+	}
+	if claims.Subject != "user-1" || claims.Name != "Анна" {
+		t.Errorf("unexpected claims: %+v", claims)
+	}
+
+	forged, _ := SignHS256(validClaims(), []byte("other"))
+	expired := validClaims()
+	expired.ExpiresAt = time.Now().Add(-time.Minute).Unix()
+	expiredToken, _ := SignHS256(expired, secret)
+	wrongIssuer := validClaims()
+	wrongIssuer.Issuer = "someone"
+	wrongIssuerToken, _ := SignHS256(wrongIssuer, secret)
+	noExpiry := validClaims()
+	noExpiry.ExpiresAt = 0
+	noExpiryToken, _ := SignHS256(noExpiry, secret)
+	parts := strings.Split(token, ".")
+	unsigned := "eyJhbGciOiJub25lIn0." + parts[1] + "."
+
+	for name, tc := range map[string]struct {
+		token string
+		err   error
+	}{
+		"forged":       {forged, ErrInvalidToken},
+		"expired":      {expiredToken, ErrTokenExpired},
+		"wrong issuer": {wrongIssuerToken, ErrInvalidToken},
+		"no expiry":    {noExpiryToken, ErrInvalidToken},
+		"alg none":     {unsigned, ErrInvalidToken},
+		"malformed":    {"abc", ErrInvalidToken},
+	} {
+		if _, err := verifier.Verify(context.Background(), tc.token); !errors.Is(err, tc.err) {
+			t.Errorf("%s: expected %v, got %v", name, tc.err, err)
+		}
+	}
+}
+
+func TestJWTVerifierLeeway(t *testing.T) {
+	secret := []byte("secret")
+	claims := validClaims()
+	claims.ExpiresAt = time.Now().Add(-10 * time.Second).Unix()
+	token, _ := SignHS256(claims, secret)
+
+	verifier := &JWTVerifier{HMACSecret: secret, Leeway: time.Minute}
+	if _, err := verifier.Verify(context.Background(), token); err != nil {
+		t.Errorf("token within leeway rejected: %v", err)
+	}
+}
+
+func TestJWTVerifierRS256(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwks, err := EncodeJWKS(map[string]*rsa.PublicKey{"k1": &key.PublicKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, jwks, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	keys, err := LoadJWKSFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier := &JWTVerifier{Keys: keys}
+
+	token, err := SignRS256(validClaims(), key, "k1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := verifier.Verify(context.Background(), token); err != nil {
+		t.Fatalf("valid token rejected: %v", err)
+	}
+
+	unknown, _ := SignRS256(validClaims(), key, "k2")
+	if _, err := verifier.Verify(context.Background(), unknown); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("expected ErrUnknownKey, got %v", err)
+	}
+
+	// An HS256 token must not be checked against the RSA keys.
+	hs, _ := SignHS256(validClaims(), key.PublicKey.N.Bytes())
+	if _, err := verifier.Verify(context.Background(), hs); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("expected ErrInvalidToken for HS256 token, got %v", err)
+	}
+}
+
+func TestJWTVerifierRejectsAlgorithmConfusion(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	jwks, _ := EncodeJWKS(map[string]*rsa.PublicKey{"k1": &key.PublicKey})
+	keys, err := ParseJWKS(jwks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := &JWKS{keys: keys}
+
+	claims := validClaims()
+	rs, _ := SignRS256(claims, key, "k1")
+	none, err := jwt.NewWithClaims(jwt.SigningMethodNone, &claims).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload := strings.Split(rs, ".")[1]
+	noneWithKID := "eyJhbGciOiJub25lIiwia2lkIjoiazEifQ." + payload + "."
+	capitalNone := "eyJhbGciOiJOb25lIn0." + payload + "."
+
+	for name, tc := range map[string]struct {
+		verifier *JWTVerifier
+		token    string
+	}{
+		"HS256 signed with the PEM public key": {&JWTVerifier{Keys: source}, signHS256(t, claims, publicPEM)},
+		"HS256 signed with the DER public key": {&JWTVerifier{Keys: source}, signHS256(t, claims, der)},
+		"HS256 with both key kinds":            {&JWTVerifier{HMACSecret: []byte("secret"), Keys: source}, signHS256(t, claims, publicPEM)},
+		"RS256 without RSA keys":               {&JWTVerifier{HMACSecret: []byte("secret")}, rs},
+		"alg none for RSA keys":                {&JWTVerifier{Keys: source}, none},
+		"alg none for a secret":                {&JWTVerifier{HMACSecret: []byte("secret")}, none},
+		"alg none with a key ID":               {&JWTVerifier{Keys: source}, noneWithKID},
+		"alg None":                             {&JWTVerifier{HMACSecret: []byte("secret"), Keys: source}, capitalNone},
+	} {
+		if _, err := tc.verifier.Verify(context.Background(), tc.token); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%s: expected ErrInvalidToken, got %v", name, err)
+		}
+	}
+}
+
+func signHS256(t *testing.T, claims Claims, secret []byte) string {
+	t.Helper()
+	token, err := SignHS256(claims, secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestRemoteJWKS(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwks, _ := EncodeJWKS(map[string]*rsa.PublicKey{"k1": &key.PublicKey})
+
+	fetches := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		w.Write(jwks)
+	}))
+	defer server.Close()
+
+	verifier := &JWTVerifier{Keys: NewRemoteJWKS(server.URL, time.Hour)}
+	token, _ := SignRS256(validClaims(), key, "k1")
+	for i := 0; i < 3; i++ {
+		if _, err := verifier.Verify(context.Background(), token); err != nil {
+			t.Fatalf("valid token rejected: %v", err)
+		}
+	}
+	if fetches != 1 {
+		t.Errorf("expected the key set to be fetched once, got %d", fetches)
+	}
+}
+
+func TestRemoteJWKSFetchesOutsideLock(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before, _ := EncodeJWKS(map[string]*rsa.PublicKey{"k1": &key.PublicKey})
+	after, _ := EncodeJWKS(map[string]*rsa.PublicKey{"k1": &key.PublicKey, "k2": &key.PublicKey})
+
+	var fetches int32
+	refetching := make(chan struct{})
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&fetches, 1) == 1 {
+			w.Write(before)
+			return
+		}
+		close(refetching)
+		<-release
+		w.Write(after)
+	}))
+	defer server.Close()
+	defer close(release)
+
+	jwks := NewRemoteJWKS(server.URL, time.Hour)
+	if _, err := jwks.Key(context.Background(), "k1"); err != nil {
+		t.Fatal(err)
+	}
+	// Let the unknown k2 trigger a refetch, which the server holds.
+	jwks.mutex.Lock()
+	jwks.fetched = time.Now().Add(-time.Minute)
+	jwks.mutex.Unlock()
+
+	results := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, err := jwks.Key(context.Background(), "k2")
+			results <- err
+		}()
+	}
+	<-refetching
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := jwks.Key(ctx, "k1"); err != nil {
+		t.Fatalf("known key blocked by the refetch: %v", err)
+	}
+
+	release <- struct{}{}
+	for i := 0; i < 2; i++ {
+		if err := <-results; err != nil {
+			t.Errorf("rotated key not found: %v", err)
+		}
+	}
+	if n := atomic.LoadInt32(&fetches); n != 2 {
+		t.Errorf("expected concurrent lookups to share one fetch, got %d fetches", n)
+	}
+}
+
+func TestUserHeaders(t *testing.T) {
+	header := http.Header{}
+	user := User{ID: "user-1", Name: "Анна Иванова", Role: RoleModerator}
+	SetUserHeaders(header, user)
+	if v := header.Get(UserNameHeader); strings.ContainsAny(v, " А") {
+		t.Errorf("name header not encoded: %q", v)
+	}
+	if got := UserFromHeaders(header); got != user {
+		t.Errorf("round trip: got %+v", got)
+	}
+
+	header = http.Header{}
+	header.Set(UserIDHeader, "user-2")
+	if got := UserFromHeaders(header); got.Role != RoleUser {
+		t.Errorf("user without role header should be a regular user: %+v", got)
+	}
+	if got := (&Claims{Subject: "user-3"}).User(); got.Role != RoleUser || got.CanModerate() {
+		t.Errorf("claims without role should be a regular user: %+v", got)
+	}
+}
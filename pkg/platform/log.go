@@ -0,0 +1,46 @@
+package platform
+
+import (
+	"context"
+	"log/slog"
+	"os"
+)
+
+type loggerKey struct{}
+
+// SetupLogging makes the default slog logger, which also receives the
+// output of the log package, write JSON lines tagged with service.
+// LOG_LEVEL sets the minimum level: debug, info (the default), warn or
+// error.
+func SetupLogging(service string) {
+	value := GetEnv("LOG_LEVEL", "info")
+	var level slog.Level
+	err := level.UnmarshalText([]byte(value))
+
+	handler := slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: level})
+	slog.SetDefault(slog.New(handler).With("service", service))
+	if err != nil {
+		slog.Warn("Invalid LOG_LEVEL, using info", "value", value)
+	}
+}
+
+// Log returns the request-scoped logger stored in ctx by the Logger
+// middleware, or the default logger outside of a request.
+func Log(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// WithLogger returns a copy of ctx whose Log is logger, for handlers that
+// add fields to every later log line.
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// Fatal logs msg and its attributes as an error and exits.
+func Fatal(msg string, args ...interface{}) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
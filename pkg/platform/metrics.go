@@ -0,0 +1,5 @@
+package platform
+
+// QueryBuckets are latency buckets in seconds for local database queries,
+// from 0.1ms to 1s. Requests to other services use prometheus.DefBuckets.
+var QueryBuckets = []float64{.0001, .0005, .001, .0025, .005, .01, .025, .05, .1, .25, 1}
@@ -0,0 +1,124 @@
+package platform
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestRequestID(t *testing.T) {
+	var requestID string
+	handler := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID = GetRequestID(r.Context())
+	}))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+	if requestID == "" {
+		t.Error("request ID not generated")
+	}
+	if rr.Header().Get(RequestIDHeader) != requestID {
+		t.Errorf("request ID not echoed: got %q want %q", rr.Header().Get(RequestIDHeader), requestID)
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(RequestIDHeader, "from-client")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if requestID != "from-client" || rr.Header().Get(RequestIDHeader) != "from-client" {
+		t.Errorf("X-Request-ID not used: got %q", requestID)
+	}
+
+	for _, invalid := range []string{"with space", "line\nbreak", strings.Repeat("a", maxRequestIDLength+1)} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set(RequestIDHeader, invalid)
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		if requestID == invalid || requestID == "" {
+			t.Errorf("invalid X-Request-ID %q not replaced: got %q", invalid, requestID)
+		}
+	}
+}
+
+func TestGetRequestIDWithoutMiddleware(t *testing.T) {
+	if requestID := GetRequestID(context.Background()); requestID != "" {
+		t.Errorf("expected no request ID, got %q", requestID)
+	}
+}
+
+func TestRecoverer(t *testing.T) {
+	handler := Recoverer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("wrong status code: got %v want %v", rr.Code, http.StatusInternalServerError)
+	}
+	var response Response
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("could not unmarshal response: %v", err)
+	}
+	if response.Error == nil || response.Error.Code != CodeInternal {
+		t.Errorf("unexpected response: %+v", response)
+	}
+}
+
+func TestLogger(t *testing.T) {
+	var buf bytes.Buffer
+	defaultLogger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, nil)))
+	defer slog.SetDefault(defaultLogger)
+
+	r := chi.NewRouter()
+	r.Use(RequestID)
+	r.Use(Logger)
+	r.Get("/items/{id}", func(w http.ResponseWriter, r *http.Request) {
+		Log(r.Context()).Info("Loading item", "id", chi.URLParam(r, "id"))
+		WriteError(w, r, http.StatusNotFound, CodeNotFound, "Item not found")
+	})
+
+	req := httptest.NewRequest("GET", "/items/7", nil)
+	req.Header.Set("X-Request-ID", "req-1")
+	req.RemoteAddr = "10.0.0.1:1234"
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 log lines, got:\n%s", buf.String())
+	}
+
+	var handlerLine, requestLine map[string]interface{}
+	json.Unmarshal(lines[0], &handlerLine)
+	json.Unmarshal(lines[1], &requestLine)
+
+	if handlerLine["request_id"] != "req-1" || handlerLine["id"] != "7" {
+		t.Errorf("handler logger not request scoped: %s", lines[0])
+	}
+	for key, want := range map[string]interface{}{
+		"level":      "WARN",
+		"request_id": "req-1",
+		"method":     "GET",
+		"route":      "/items/{id}",
+		"path":       "/items/7",
+		"status":     float64(http.StatusNotFound),
+		"remote_ip":  "10.0.0.1",
+	} {
+		if requestLine[key] != want {
+			t.Errorf("%s: got %v want %v", key, requestLine[key], want)
+		}
+	}
+	if size, _ := requestLine["bytes"].(float64); size == 0 {
+		t.Errorf("response size not logged: %s", lines[1])
+	}
+	if _, ok := requestLine["latency_ms"].(float64); !ok {
+		t.Errorf("latency not logged: %s", lines[1])
+	}
+}
@@ -0,0 +1,68 @@
+package platform
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// Migration is a versioned schema change.
+type Migration struct {
+	Version int
+	Name    string
+	Query   string
+	// Backfill optionally migrates existing rows after Query has run.
+	Backfill func(tx *sql.Tx) error
+}
+
+// Migrate applies every migration newer than the version recorded in the
+// schema_migrations table, each in its own transaction. Migrations must be
+// sorted by version; never edit an applied migration, append a new one
+// instead.
+func Migrate(db *sql.DB, migrations []Migration) error {
+	_, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`)
+	if err != nil {
+		return err
+	}
+
+	var current int
+	if err := db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&current); err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if m.Version <= current {
+			continue
+		}
+		if err := applyMigration(db, m); err != nil {
+			return fmt.Errorf("migration %d (%s): %w", m.Version, m.Name, err)
+		}
+	}
+	return nil
+}
+
+func applyMigration(db *sql.DB, m Migration) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(m.Query); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if m.Backfill != nil {
+		if err := m.Backfill(tx); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if _, err := tx.Exec("INSERT INTO schema_migrations (version, name) VALUES (?, ?)", m.Version, m.Name); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
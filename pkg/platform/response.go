@@ -0,0 +1,114 @@
+// Package platform holds the primitives shared by the news services.
+package platform
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+)
+
+// Response is the JSON envelope returned by every endpoint.
+type Response struct {
+	Status     string      `json:"status"`
+	Data       interface{} `json:"data,omitempty"`
+	Error      *Error      `json:"error,omitempty"`
+	Pagination *Pagination `json:"pagination,omitempty"`
+}
+
+// Pagination describes a page of a listing. Page is omitted for cursor
+// pagination, NextCursor when there are no more items.
+type Pagination struct {
+	Page       int    `json:"page,omitempty"`
+	PageSize   int    `json:"page_size"`
+	Total      int    `json:"total"`
+	TotalPages int    `json:"total_pages"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// Error is the error part of a failed Response.
+type Error struct {
+	// Code is a stable machine-readable identifier, one of the Code
+	// constants.
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// Error codes.
+const (
+	CodeInvalidRequest      = "invalid_request"
+	CodeUnauthorized        = "unauthorized"
+	CodeForbidden           = "forbidden"
+	CodeNotFound            = "not_found"
+	CodeMethodNotAllowed    = "method_not_allowed"
+	CodeConflict            = "conflict"
+	CodeProhibitedContent   = "prohibited_content"
+	CodeInternal            = "internal_error"
+	CodeTimeout             = "timeout"
+	CodeUpstreamUnavailable = "upstream_unavailable"
+	CodeUpstreamTimeout     = "upstream_timeout"
+)
+
+// CodeForStatus returns the default error code for an HTTP status.
+func CodeForStatus(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return CodeInvalidRequest
+	case http.StatusUnauthorized:
+		return CodeUnauthorized
+	case http.StatusForbidden:
+		return CodeForbidden
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusMethodNotAllowed:
+		return CodeMethodNotAllowed
+	case http.StatusConflict:
+		return CodeConflict
+	case http.StatusBadGateway, http.StatusServiceUnavailable:
+		return CodeUpstreamUnavailable
+	case http.StatusGatewayTimeout:
+		return CodeUpstreamTimeout
+	}
+	if status >= 500 {
+		return CodeInternal
+	}
+	return CodeInvalidRequest
+}
+
+// WriteJSON writes v as a JSON body with the given status.
+func WriteJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("Failed to write response", "error", err)
+	}
+}
+
+// WriteError writes an error Response carrying the request ID of r.
+func WriteError(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	WriteJSON(w, status, ErrorResponse(r, code, message))
+}
+
+// ErrorResponse builds the error Response WriteError sends, for handlers
+// that need the envelope without writing it.
+func ErrorResponse(r *http.Request, code, message string) Response {
+	return Response{
+		Status: "error",
+		Error: &Error{
+			Code:      code,
+			Message:   message,
+			RequestID: GetRequestID(r.Context()),
+		},
+	}
+}
+
+// NotFound answers requests to unknown routes.
+func NotFound(w http.ResponseWriter, r *http.Request) {
+	WriteError(w, r, http.StatusNotFound, CodeNotFound, "Not found")
+}
+
+// MethodNotAllowed answers requests with a method the route does not
+// support.
+func MethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	WriteError(w, r, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed")
+}
@@ -0,0 +1,32 @@
+package platform
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWriteError(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	req = req.WithContext(WithRequestID(req.Context(), "test-id"))
+	rr := httptest.NewRecorder()
+
+	WriteError(rr, req, http.StatusNotFound, CodeNotFound, "News not found")
+
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("wrong status code: got %v want %v", rr.Code, http.StatusNotFound)
+	}
+	if contentType := rr.Header().Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("wrong content type: %q", contentType)
+	}
+
+	var response Response
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("could not unmarshal response: %v", err)
+	}
+	want := Error{Code: CodeNotFound, Message: "News not found", RequestID: "test-id"}
+	if response.Status != "error" || response.Error == nil || *response.Error != want {
+		t.Errorf("unexpected response: %+v", response)
+	}
+}
@@ -0,0 +1,129 @@
+package platform
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"net/http"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// defaultShutdownTimeout bounds how long in-flight requests may take to
+// finish once shutdown starts.
+const defaultShutdownTimeout = 15 * time.Second
+
+// Server is an HTTP server with the middleware shared by every service.
+// Routes are registered on Router before calling Run.
+type Server struct {
+	Name   string
+	Router chi.Router
+	// DrainDelay keeps serving after shutdown starts while readiness
+	// reports not ready, so load balancers stop routing new traffic
+	// first. Read from SHUTDOWN_DRAIN_DELAY.
+	DrainDelay time.Duration
+	// ShutdownTimeout is the deadline for in-flight requests to finish,
+	// read from SHUTDOWN_TIMEOUT.
+	ShutdownTimeout time.Duration
+
+	server *http.Server
+	ready  atomic.Bool
+	checks []HealthCheck
+}
+
+// NewServer creates a server listening on port. The router logs and traces
+// requests, tags them with a request ID, recovers from panics and answers
+// unknown routes with the JSON error envelope. /health and /health/live
+// report that the process is up, /health/ready whether it accepts traffic
+// and /metrics exposes the default Prometheus registry.
+func NewServer(name, port string) *Server {
+	r := chi.NewRouter()
+
+	r.Use(middleware.RealIP)
+	r.Use(RequestID)
+	r.Use(Tracing)
+	r.Use(Logger)
+	r.Use(Metrics)
+	r.Use(Recoverer)
+	r.NotFound(NotFound)
+	r.MethodNotAllowed(MethodNotAllowed)
+
+	s := &Server{
+		Name:            name,
+		Router:          r,
+		DrainDelay:      GetDurationEnv("SHUTDOWN_DRAIN_DELAY", 0),
+		ShutdownTimeout: GetDurationEnv("SHUTDOWN_TIMEOUT", defaultShutdownTimeout),
+		server: &http.Server{
+			Addr:    ":" + port,
+			Handler: r,
+		},
+	}
+	r.Get("/health", HealthHandler)
+	r.Get("/health/live", HealthHandler)
+	r.Get("/health/ready", s.readyHandler)
+	r.Method(http.MethodGet, "/metrics", promhttp.Handler())
+	return s
+}
+
+// Ready reports whether the server accepts traffic. It turns false as soon
+// as shutdown starts.
+func (s *Server) Ready() bool {
+	return s.ready.Load()
+}
+
+// Run serves requests until the process receives SIGINT or SIGTERM, then
+// shuts down gracefully. It returns an error if the server cannot start.
+func (s *Server) Run() error {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	listener, err := net.Listen("tcp", s.server.Addr)
+	if err != nil {
+		return err
+	}
+	slog.Info("Server starting", "server", s.Name, "addr", s.server.Addr)
+	return s.Serve(ctx, listener)
+}
+
+// Serve serves requests on listener until ctx is done. It then marks the
+// server not ready, keeps serving for DrainDelay, stops accepting
+// connections and waits up to ShutdownTimeout for in-flight requests
+// before closing them. Callers stop background workers after Serve
+// returns, once no request can use them anymore.
+func (s *Server) Serve(ctx context.Context, listener net.Listener) error {
+	errs := make(chan error, 1)
+	go func() {
+		errs <- s.server.Serve(listener)
+	}()
+	s.ready.Store(true)
+
+	select {
+	case err := <-errs:
+		s.ready.Store(false)
+		return err
+	case <-ctx.Done():
+	}
+
+	slog.Info("Server shutting down, draining requests", "server", s.Name, "timeout", s.ShutdownTimeout.String())
+	s.ready.Store(false)
+	if s.DrainDelay > 0 {
+		time.Sleep(s.DrainDelay)
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.ShutdownTimeout)
+	defer cancel()
+	if err := s.server.Shutdown(shutdownCtx); err != nil {
+		slog.Warn("Shutdown deadline exceeded, closing remaining connections", "error", err)
+		s.server.Close()
+	}
+	<-errs
+
+	slog.Info("Server stopped gracefully", "server", s.Name)
+	return nil
+}
@@ -0,0 +1,145 @@
+package platform
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHealthHandler(t *testing.T) {
+	rr := httptest.NewRecorder()
+	HealthHandler(rr, httptest.NewRequest("GET", "/health", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	var response Response
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("could not unmarshal response: %v", err)
+	}
+	if response.Status != "ok" {
+		t.Errorf("handler returned unexpected status: got %v want %v", response.Status, "ok")
+	}
+}
+
+func TestNewServerRouting(t *testing.T) {
+	server := NewServer("Test Service", "0")
+
+	tests := []struct {
+		method string
+		path   string
+		status int
+		code   string
+	}{
+		{"GET", "/health", http.StatusOK, ""},
+		{"GET", "/missing", http.StatusNotFound, CodeNotFound},
+		{"POST", "/health", http.StatusMethodNotAllowed, CodeMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		server.Router.ServeHTTP(rr, httptest.NewRequest(tt.method, tt.path, nil))
+
+		if rr.Code != tt.status {
+			t.Errorf("%s %s: got status %d want %d", tt.method, tt.path, rr.Code, tt.status)
+			continue
+		}
+		var response Response
+		if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+			t.Fatalf("%s %s: could not unmarshal response: %v", tt.method, tt.path, err)
+		}
+		if tt.code != "" && (response.Error == nil || response.Error.Code != tt.code || response.Error.RequestID == "") {
+			t.Errorf("%s %s: unexpected error %+v", tt.method, tt.path, response.Error)
+		}
+	}
+}
+
+func TestServeDrainsInFlightRequests(t *testing.T) {
+	server := NewServer("Test Service", "0")
+	server.ShutdownTimeout = time.Second
+
+	started := make(chan struct{})
+	server.Router.Get("/slow", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(200 * time.Millisecond)
+		WriteJSON(w, http.StatusOK, Response{Status: "success"})
+	})
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() { served <- server.Serve(ctx, listener) }()
+
+	responses := make(chan int, 1)
+	go func() {
+		resp, err := http.Get("http://" + listener.Addr().String() + "/slow")
+		if err != nil {
+			t.Errorf("in-flight request failed: %v", err)
+			responses <- 0
+			return
+		}
+		resp.Body.Close()
+		responses <- resp.StatusCode
+	}()
+
+	<-started
+	if !server.Ready() {
+		t.Error("expected server to be ready while serving")
+	}
+	cancel()
+
+	if status := <-responses; status != http.StatusOK {
+		t.Errorf("in-flight request got status %d", status)
+	}
+	if err := <-served; err != nil {
+		t.Errorf("Serve returned %v", err)
+	}
+	if server.Ready() {
+		t.Error("expected server not to be ready after shutdown")
+	}
+}
+
+func TestReadyHandlerDuringDrain(t *testing.T) {
+	server := NewServer("Test Service", "0")
+	server.DrainDelay = 300 * time.Millisecond
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() { served <- server.Serve(ctx, listener) }()
+
+	url := "http://" + listener.Addr().String() + "/health/ready"
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected ready before shutdown, got %d", resp.StatusCode)
+	}
+
+	cancel()
+	time.Sleep(50 * time.Millisecond)
+	resp, err = http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("expected not ready while draining, got %d", resp.StatusCode)
+	}
+
+	if err := <-served; err != nil {
+		t.Errorf("Serve returned %v", err)
+	}
+}
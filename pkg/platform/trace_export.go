@@ -0,0 +1,79 @@
+package platform
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// flushTimeout bounds the export of pending spans at shutdown.
+const flushTimeout = 5 * time.Second
+
+// SetupTracing installs the OpenTelemetry tracer provider of the process
+// and exports its spans as configured by OTEL_TRACES_EXPORTER: "otlp"
+// sends them over OTLP/HTTP to OTEL_EXPORTER_OTLP_ENDPOINT, "stdout"
+// prints them and "file" appends them to OTEL_TRACES_FILE. With "none", the
+// default, spans are still created and their context propagated but
+// nothing is exported. OTEL_SERVICE_NAME overrides service. The returned
+// function flushes pending spans and stops exporting.
+func SetupTracing(service string) func() {
+	service = GetEnv("OTEL_SERVICE_NAME", service)
+
+	options := []sdktrace.TracerProviderOption{
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", service))),
+	}
+	if exporter := newSpanExporter(); exporter != nil {
+		options = append(options, sdktrace.WithBatcher(exporter))
+	}
+	provider := sdktrace.NewTracerProvider(options...)
+	otel.SetTracerProvider(provider)
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), flushTimeout)
+		defer cancel()
+		if err := provider.Shutdown(ctx); err != nil {
+			slog.Error("Failed to flush spans", "error", err)
+		}
+	}
+}
+
+// newSpanExporter returns the exporter selected by OTEL_TRACES_EXPORTER, or
+// nil when spans are not exported.
+func newSpanExporter() sdktrace.SpanExporter {
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch name := GetEnv("OTEL_TRACES_EXPORTER", "none"); name {
+	case "none":
+		return nil
+	case "otlp":
+		// Reads OTEL_EXPORTER_OTLP_ENDPOINT, http://localhost:4318 by
+		// default.
+		exporter, err = otlptracehttp.New(context.Background())
+	case "stdout":
+		exporter, err = stdouttrace.New()
+	case "file":
+		path := GetEnv("OTEL_TRACES_FILE", "traces.jsonl")
+		file, openErr := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if openErr != nil {
+			slog.Error("Failed to open traces file, not exporting spans", "path", path, "error", openErr)
+			return nil
+		}
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(file))
+	default:
+		slog.Warn("Unknown OTEL_TRACES_EXPORTER, not exporting spans", "value", name)
+		return nil
+	}
+	if err != nil {
+		slog.Error("Failed to create span exporter, not exporting spans", "error", err)
+		return nil
+	}
+	return exporter
+}
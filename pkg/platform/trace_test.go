@@ -0,0 +1,106 @@
+package platform
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// recordSpans installs a tracer provider that records ended spans for the
+// rest of the test.
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	return recorder
+}
+
+func TestTracingContinuesTrace(t *testing.T) {
+	recorder := recordSpans(t)
+
+	server := NewServer("Test Service", "0")
+	var outgoing http.Header
+	server.Router.Get("/items/{id}", func(w http.ResponseWriter, r *http.Request) {
+		_, span := otel.Tracer("test").Start(r.Context(), "load item")
+		span.End()
+
+		outgoing = http.Header{}
+		InjectTrace(r.Context(), outgoing)
+	})
+
+	req := httptest.NewRequest("GET", "/items/1", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	req.Header.Set("tracestate", "vendor=value")
+	server.Router.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(spans))
+	}
+	childSpan, serverSpan := spans[0], spans[1]
+	if serverSpan.Name() != "GET /items/{id}" || serverSpan.SpanKind() != trace.SpanKindServer ||
+		serverSpan.Parent().SpanID().String() != "00f067aa0ba902b7" ||
+		serverSpan.SpanContext().TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("unexpected server span %q: %+v", serverSpan.Name(), serverSpan.SpanContext())
+	}
+	if childSpan.Name() != "load item" || childSpan.Parent().SpanID() != serverSpan.SpanContext().SpanID() {
+		t.Errorf("child not linked to the server span: %+v", childSpan.Parent())
+	}
+
+	want := "00-4bf92f3577b34da6a3ce929d0e0e4736-" + serverSpan.SpanContext().SpanID().String() + "-01"
+	if outgoing.Get("traceparent") != want {
+		t.Errorf("unexpected outgoing traceparent %q want %q", outgoing.Get("traceparent"), want)
+	}
+	if outgoing.Get("tracestate") != "vendor=value" {
+		t.Errorf("tracestate not propagated: %q", outgoing.Get("tracestate"))
+	}
+}
+
+func TestTracingRejectsInvalidTraceparent(t *testing.T) {
+	recorder := recordSpans(t)
+
+	server := NewServer("Test Service", "0")
+	req := httptest.NewRequest("GET", "/health", nil)
+	req.Header.Set("traceparent", "00-00000000000000000000000000000000-00f067aa0ba902b7-01")
+	server.Router.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := recorder.Ended()
+	if len(spans) != 1 || spans[0].Parent().IsValid() || !spans[0].SpanContext().IsValid() {
+		t.Errorf("expected a new root span for an invalid traceparent, got %+v", spans)
+	}
+}
+
+func TestSetupTracingExportsOTLP(t *testing.T) {
+	var exports int32
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" || r.Header.Get("Content-Type") != "application/x-protobuf" {
+			t.Errorf("unexpected export request %s %s", r.URL.Path, r.Header.Get("Content-Type"))
+		}
+		atomic.AddInt32(&exports, 1)
+	}))
+	defer collector.Close()
+
+	t.Setenv("OTEL_TRACES_EXPORTER", "otlp")
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", collector.URL)
+	previous := otel.GetTracerProvider()
+	defer otel.SetTracerProvider(previous)
+
+	flush := SetupTracing("test-service")
+	_, span := otel.Tracer("test").Start(context.Background(), "query")
+	span.End()
+	flush()
+
+	if atomic.LoadInt32(&exports) != 1 {
+		t.Errorf("expected 1 export, got %d", exports)
+	}
+}
@@ -0,0 +1,106 @@
+package platform
+
+import (
+	"crypto/subtle"
+	"log/slog"
+	"net/http"
+	"net/url"
+)
+
+// Headers carrying the user verified by the gateway to internal services.
+// Services trust them only on requests that TrustGateway authenticated.
+const (
+	UserIDHeader   = "X-User-ID"
+	UserNameHeader = "X-User-Name"
+	UserRoleHeader = "X-User-Role"
+)
+
+// GatewaySecretHeader carries the secret the gateway shares with the
+// services, vouching for the user headers of a request.
+const GatewaySecretHeader = "X-Gateway-Secret"
+
+// User roles. Every user may act on their own content, moderators and
+// admins on anyone's, and only admins change roles.
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+// ValidRole reports whether role is one of the Role constants.
+func ValidRole(role string) bool {
+	return role == RoleUser || role == RoleModerator || role == RoleAdmin
+}
+
+// User is an authenticated caller. The ID is empty for anonymous requests.
+type User struct {
+	ID   string
+	Name string
+	Role string
+}
+
+// CanModerate reports whether u may act on content of other users.
+func (u User) CanModerate() bool {
+	return u.Role == RoleModerator || u.Role == RoleAdmin
+}
+
+// User returns the user the claims were issued to. Tokens without a role
+// claim belong to regular users.
+func (c *Claims) User() User {
+	role := c.Role
+	if role == "" {
+		role = RoleUser
+	}
+	return User{ID: c.Subject, Name: c.Name, Role: role}
+}
+
+// SetUserHeaders sets the user headers on an outgoing request. The name is
+// percent-encoded since header values are not reliably UTF-8.
+func SetUserHeaders(header http.Header, user User) {
+	header.Set(UserIDHeader, user.ID)
+	header.Set(UserRoleHeader, user.Role)
+	if user.Name != "" {
+		header.Set(UserNameHeader, url.PathEscape(user.Name))
+	} else {
+		header.Del(UserNameHeader)
+	}
+}
+
+// UserFromHeaders returns the user set by SetUserHeaders. A user without
+// a role header is a regular user.
+func UserFromHeaders(header http.Header) User {
+	user := User{ID: header.Get(UserIDHeader), Role: header.Get(UserRoleHeader)}
+	name, err := url.PathUnescape(header.Get(UserNameHeader))
+	if err != nil {
+		name = header.Get(UserNameHeader)
+	}
+	user.Name = name
+	if user.ID != "" && user.Role == "" {
+		user.Role = RoleUser
+	}
+	return user
+}
+
+// TrustGateway removes the user headers from requests that do not carry
+// secret in GatewaySecretHeader, so that only the gateway can act on
+// behalf of a user. With an empty secret every request is anonymous.
+func TrustGateway(secret string) func(http.Handler) http.Handler {
+	if secret == "" {
+		slog.Warn("No gateway secret configured, user headers are ignored")
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			given := r.Header.Get(GatewaySecretHeader)
+			r.Header.Del(GatewaySecretHeader)
+			if secret == "" || subtle.ConstantTimeCompare([]byte(given), []byte(secret)) != 1 {
+				if r.Header.Get(UserIDHeader) != "" {
+					Log(r.Context()).Warn("Ignoring user headers without the gateway secret")
+				}
+				r.Header.Del(UserIDHeader)
+				r.Header.Del(UserNameHeader)
+				r.Header.Del(UserRoleHeader)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
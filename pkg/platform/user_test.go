@@ -0,0 +1,44 @@
+package platform
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTrustGateway(t *testing.T) {
+	moderator := User{ID: "user-1", Name: "Анна", Role: RoleModerator}
+
+	for _, tt := range []struct {
+		name   string
+		secret string
+		given  string
+		want   User
+	}{
+		{"valid secret", "secret", "secret", moderator},
+		{"wrong secret", "secret", "guess", User{}},
+		{"missing secret", "secret", "", User{}},
+		{"no secret configured", "", "", User{}},
+	} {
+		var got User
+		var leaked string
+		handler := TrustGateway(tt.secret)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got = UserFromHeaders(r.Header)
+			leaked = r.Header.Get(GatewaySecretHeader)
+		}))
+
+		req := httptest.NewRequest("DELETE", "/comments/1", nil)
+		SetUserHeaders(req.Header, moderator)
+		if tt.given != "" {
+			req.Header.Set(GatewaySecretHeader, tt.given)
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		if got != tt.want {
+			t.Errorf("%s: got user %+v want %+v", tt.name, got, tt.want)
+		}
+		if leaked != "" {
+			t.Errorf("%s: secret header passed to the handler", tt.name)
+		}
+	}
+}